@@ -0,0 +1,25 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Codecs of the blocks of Avro object container files
+const (
+	AvroCodecNull    = "null"
+	AvroCodecDeflate = "deflate"
+	AvroCodecSnappy  = "snappy"
+)
+
+// AvroDetails - options of the AVRO_OCF format. Codec compresses the
+// blocks of the container files, null by default. BatchSize is the number
+// of events written to each file, 1 by default, and BatchInterval the
+// longest time in milliseconds an event waits for its file to be full.
+// Distro sets the default interval
+type AvroDetails struct {
+	Codec         string `bson:"codec,omitempty" json:"codec,omitempty"`
+	BatchSize     int    `bson:"batchSize,omitempty" json:"batchSize,omitempty"`
+	BatchInterval int    `bson:"batchInterval,omitempty" json:"batchInterval,omitempty"`
+}
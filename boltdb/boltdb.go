@@ -0,0 +1,284 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// BucketName - bucket holding the registrations as JSON, keyed by ID
+// HistoryBucketName - bucket with a nested bucket per registration ID,
+// holding its versions as JSON keyed by big endian version number
+const (
+	BucketName        string = "exportConfiguration"
+	HistoryBucketName string = "exportHistory"
+)
+
+// Repository - registrations stored in an embedded Bolt database, for
+// gateways that can not run a Mongo server
+type Repository struct {
+	DB *bolt.DB
+}
+
+// NewRepository - open or create the Bolt database at path
+func NewRepository(path string) (*Repository, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(BucketName)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(HistoryBucketName))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Repository{DB: db}, nil
+}
+
+// Close - close the database
+func (r *Repository) Close() error {
+	return r.DB.Close()
+}
+
+// forEach - call fn for every registration until it returns false
+func forEach(b *bolt.Bucket, fn func(reg export.Registration) (bool, error)) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		reg := export.Registration{}
+		if err := json.Unmarshal(v, &reg); err != nil {
+			return err
+		}
+		next, err := fn(reg)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+func findByName(b *bolt.Bucket, name string) (export.Registration, error) {
+	found := export.Registration{}
+	err := forEach(b, func(reg export.Registration) (bool, error) {
+		if reg.Name == name {
+			found = reg
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == nil && found.ID == "" {
+		err = export.ErrNotFound
+	}
+	return found, err
+}
+
+func put(b *bolt.Bucket, reg export.Registration) error {
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(reg.ID.Hex()), data)
+}
+
+// Registrations - get registrations matching the query
+func (r *Repository) Registrations(q export.RegistrationQuery) ([]export.Registration, int, error) {
+	regs := []export.Registration{}
+	err := r.DB.View(func(tx *bolt.Tx) error {
+		return forEach(tx.Bucket([]byte(BucketName)), func(reg export.Registration) (bool, error) {
+			regs = append(regs, reg)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	regs, total := q.Apply(regs)
+	return regs, total, nil
+}
+
+// RegistrationByID - get registration by ID
+func (r *Repository) RegistrationByID(id string) (export.Registration, error) {
+	reg := export.Registration{}
+	err := r.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(BucketName)).Get([]byte(id))
+		if data == nil {
+			return export.ErrNotFound
+		}
+		return json.Unmarshal(data, &reg)
+	})
+	return reg, err
+}
+
+// RegistrationByName - get registration by name
+func (r *Repository) RegistrationByName(name string) (export.Registration, error) {
+	reg := export.Registration{}
+	err := r.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		reg, err = findByName(tx.Bucket([]byte(BucketName)), name)
+		return err
+	})
+	return reg, err
+}
+
+// AddRegistration - add a new registration
+func (r *Repository) AddRegistration(reg export.Registration) (string, error) {
+	if reg.ID == "" {
+		reg.ID = bson.NewObjectId()
+	}
+
+	err := r.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if _, err := findByName(b, reg.Name); err != export.ErrNotFound {
+			if err == nil {
+				err = export.ErrDuplicateName
+			}
+			return err
+		}
+		return put(b, reg)
+	})
+	if err != nil {
+		return "", err
+	}
+	return reg.ID.Hex(), nil
+}
+
+// UpdateRegistration - replace the registration with the same ID, if its
+// modified value did not change
+func (r *Repository) UpdateRegistration(reg export.Registration, modified int64) error {
+	return r.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		data := b.Get([]byte(reg.ID.Hex()))
+		if reg.ID == "" || data == nil {
+			return export.ErrNotFound
+		}
+
+		old := export.Registration{}
+		if err := json.Unmarshal(data, &old); err != nil {
+			return err
+		}
+		if old.Modified != modified {
+			return export.ErrConflict
+		}
+
+		other, err := findByName(b, reg.Name)
+		if err == nil && other.ID != reg.ID {
+			return export.ErrDuplicateName
+		} else if err != nil && err != export.ErrNotFound {
+			return err
+		}
+		return put(b, reg)
+	})
+}
+
+// DeleteRegistrationByID - delete registration by ID
+func (r *Repository) DeleteRegistrationByID(id string) error {
+	return r.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if b.Get([]byte(id)) == nil {
+			return export.ErrNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// DeleteRegistrationByName - delete registration by name
+func (r *Repository) DeleteRegistrationByName(name string) error {
+	return r.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		reg, err := findByName(b, name)
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(reg.ID.Hex()))
+	})
+}
+
+func versionKey(version int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(version))
+	return key
+}
+
+// AddVersion - add the next version of a registration
+func (r *Repository) AddVersion(v export.RegistrationVersion) (int, error) {
+	err := r.DB.Update(func(tx *bolt.Tx) error {
+		id := []byte(v.RegistrationID.Hex())
+		b, err := tx.Bucket([]byte(HistoryBucketName)).CreateBucketIfNotExists(id)
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		v.Version = int(seq)
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return b.Put(versionKey(v.Version), data)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v.Version, nil
+}
+
+// Versions - get the versions of a registration
+func (r *Repository) Versions(id string) ([]export.RegistrationVersion, error) {
+	versions := []export.RegistrationVersion{}
+	err := r.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(HistoryBucketName)).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, data []byte) error {
+			v := export.RegistrationVersion{}
+			if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			versions = append(versions, v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Version - get a version of a registration
+func (r *Repository) Version(id string, version int) (export.RegistrationVersion, error) {
+	v := export.RegistrationVersion{}
+	err := r.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(HistoryBucketName)).Bucket([]byte(id))
+		if b == nil || version < 1 {
+			return export.ErrVersionNotFound
+		}
+		data := b.Get(versionKey(version))
+		if data == nil {
+			return export.ErrVersionNotFound
+		}
+		return json.Unmarshal(data, &v)
+	})
+	return v, err
+}
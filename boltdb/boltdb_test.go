@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package boltdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	id, err := r.AddRegistration(export.Registration{Name: "reg1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddRegistration(export.Registration{Name: "reg1"}); err != export.ErrDuplicateName {
+		t.Fatal("Expected duplicate name error got", err)
+	}
+
+	reg, err := r.RegistrationByID(id)
+	if err != nil || reg.Name != "reg1" {
+		t.Fatal("Could not get registration by id", err)
+	}
+
+	reg.Format = export.FormatXML
+	reg.Modified = 1
+	if err := r.UpdateRegistration(reg, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateRegistration(reg, 0); err != export.ErrConflict {
+		t.Fatal("Expected conflict error got", err)
+	}
+	reg, err = r.RegistrationByName("reg1")
+	if err != nil || reg.Format != export.FormatXML || reg.ID.Hex() != id {
+		t.Fatal("Registration was not updated", reg, err)
+	}
+
+	if err := r.UpdateRegistration(export.Registration{Name: "unknown"}, 0); err != export.ErrNotFound {
+		t.Fatal("Expected not found error got", err)
+	}
+
+	if _, err := r.AddRegistration(export.Registration{Name: "reg2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reg.Name = "reg2"
+	if err := r.UpdateRegistration(reg, 1); err != export.ErrDuplicateName {
+		t.Fatal("Expected duplicate name error got", err)
+	}
+	reg.Name = "renamed"
+	if err := r.UpdateRegistration(reg, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reg, err = r.RegistrationByID(id); err != nil || reg.Name != "renamed" {
+		t.Fatal("Registration was not renamed", reg, err)
+	}
+
+	regs, total, err := r.Registrations(export.RegistrationQuery{})
+	if err != nil || len(regs) != 2 || total != 2 {
+		t.Fatal("Expected two registrations", regs, err)
+	}
+
+	if err := r.DeleteRegistrationByID(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteRegistrationByName("reg2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteRegistrationByName("reg2"); err != export.ErrNotFound {
+		t.Fatal("Expected not found error got", err)
+	}
+	if _, err := r.RegistrationByID(id); err != export.ErrNotFound {
+		t.Fatal("Expected not found error got", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	id := bson.NewObjectId()
+	for i, name := range []string{"reg1", "reg2"} {
+		v := export.RegistrationVersion{
+			RegistrationID: id,
+			Operation:      export.NotifyUpdateUpdate,
+			Registration:   &export.Registration{ID: id, Name: name},
+		}
+		n, err := r.AddVersion(v)
+		if err != nil || n != i+1 {
+			t.Fatal("Unexpected version", n, err)
+		}
+	}
+	if _, err := r.AddVersion(export.RegistrationVersion{RegistrationID: bson.NewObjectId()}); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := r.Versions(id.Hex())
+	if err != nil || len(versions) != 2 || versions[0].Version != 1 ||
+		versions[1].Registration.Name != "reg2" {
+		t.Fatal("Unexpected versions", versions, err)
+	}
+	if versions, err := r.Versions(bson.NewObjectId().Hex()); err != nil || len(versions) != 0 {
+		t.Fatal("Expected no versions", versions, err)
+	}
+
+	v, err := r.Version(id.Hex(), 1)
+	if err != nil || v.Registration.Name != "reg1" {
+		t.Fatal("Unexpected version", v, err)
+	}
+	if _, err := r.Version(id.Hex(), 3); err != export.ErrVersionNotFound {
+		t.Fatal("Expected version not found error got", err)
+	}
+}
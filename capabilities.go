@@ -0,0 +1,232 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Filter types
+const (
+	FilterDevice          = "DEVICE"
+	FilterValueDescriptor = "VALUE_DESCRIPTOR"
+)
+
+// Capabilities - values of the registration fields supported by distro, for
+// each stage of the export pipeline
+type Capabilities struct {
+	Formats      []Capability `json:"formats"`
+	Compressions []Capability `json:"compressions"`
+	Algorithms   []Capability `json:"algorithms"`
+	Destinations []Capability `json:"destinations"`
+	Filters      []Capability `json:"filters"`
+}
+
+// Capability - supported value of a registration field, with the fields
+// configuring it
+type Capability struct {
+	Name       string      `json:"name"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+}
+
+// Parameter - registration field configuring a capability. Field is the
+// path of the field in the JSON document, like "addressable.Port". Values
+// lists the accepted values, and Min and Max the range of numbers if Max
+// is set
+type Parameter struct {
+	Field    string   `json:"field"`
+	Required bool     `json:"required,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Min      int      `json:"min,omitempty"`
+	Max      int      `json:"max,omitempty"`
+}
+
+var (
+	addressParameters = []Parameter{
+		{Field: "addressable.Address", Required: true},
+		{Field: "addressable.Port", Required: true, Min: 1, Max: 65535},
+	}
+	mqttParameters = append(addressParameters,
+		Parameter{Field: "addressable.Topic", Required: true},
+		Parameter{Field: "addressable.Publisher"},
+		Parameter{Field: "addressable.User"},
+		Parameter{Field: "addressable.Password"},
+	)
+	restParameters = append(addressParameters,
+		Parameter{Field: "addressable.Path"},
+		Parameter{Field: "addressable.Method", Required: true, Values: []string{MethodGet, MethodPost}},
+	)
+	senmlParameters = []Parameter{
+		{Field: "senml.units"},
+	}
+	influxPrecision = Parameter{Field: "influx.precision",
+		Values: []string{InfluxPrecisionNs, InfluxPrecisionUs, InfluxPrecisionMs, InfluxPrecisionS}}
+	influxDBParameters = append(addressParameters,
+		Parameter{Field: "addressable.Path"},
+		Parameter{Field: "addressable.Password", Required: true},
+		Parameter{Field: "influx.bucket", Required: true},
+		Parameter{Field: "influx.org", Required: true},
+		influxPrecision,
+	)
+)
+
+// DefaultCapabilities - capabilities of the distro of this release, used
+// to validate registrations when distro can not be asked for its own
+func DefaultCapabilities() Capabilities {
+	return Capabilities{
+		Formats: []Capability{
+			{Name: FormatJSON, Parameters: []Parameter{
+				{Field: "mapping.include"},
+				{Field: "mapping.exclude"},
+				{Field: "mapping.rename"},
+				{Field: "mapping.flatten"},
+				{Field: "mapping.timeFormat", Values: []string{MappingTimeMillis, MappingTimeRFC3339}},
+				{Field: "mapping.typedValues"},
+			}},
+			{Name: FormatXML, Parameters: []Parameter{
+				{Field: "xml.root"},
+				{Field: "xml.namespace"},
+				{Field: "xml.prefix"},
+				{Field: "xml.readings", Values: []string{XMLReadingsElements, XMLReadingsAttributes}},
+			}},
+			{Name: FormatMsgPack},
+			{Name: FormatCBOR},
+			{Name: FormatAvro},
+			{Name: FormatAvroOCF, Parameters: []Parameter{
+				{Field: "avro.codec", Values: []string{AvroCodecNull, AvroCodecDeflate, AvroCodecSnappy}},
+				{Field: "avro.batchSize", Min: 1, Max: 10000},
+				{Field: "avro.batchInterval", Min: 1, Max: 60000},
+			}},
+			{Name: FormatScript, Parameters: []Parameter{
+				{Field: "script.source", Required: true},
+				{Field: "script.language", Values: []string{ScriptLua}},
+				{Field: "script.timeout", Min: 1, Max: 10000},
+				{Field: "script.memoryLimit", Min: 32, Max: 1024},
+				{Field: "script.stackLimit", Min: 1024, Max: 1024 * 1024},
+			}},
+			{Name: FormatTemplate, Parameters: []Parameter{
+				{Field: "template.source", Required: true},
+				{Field: "template.contentType"},
+			}},
+			{Name: FormatSenMLJSON, Parameters: senmlParameters},
+			{Name: FormatSenMLCBOR, Parameters: senmlParameters},
+			{Name: FormatInfluxLine, Parameters: []Parameter{
+				{Field: "influx.measurement", Values: []string{InfluxMeasurementReading, InfluxMeasurementDevice}},
+				{Field: "influx.tags"},
+				influxPrecision,
+			}},
+			{Name: FormatSparkplugB, Parameters: []Parameter{
+				{Field: "sparkplug.groupId", Required: true},
+				{Field: "sparkplug.nodeId", Required: true},
+			}},
+		},
+		Compressions: []Capability{
+			{Name: CompNone},
+			{Name: CompGzip},
+			{Name: CompZip},
+		},
+		Algorithms: []Capability{
+			{Name: EncNone},
+			{Name: EncAes, Parameters: []Parameter{
+				{Field: "encryption.encryptionKey", Required: true},
+				{Field: "encryption.initializingVector", Required: true},
+			}},
+		},
+		Destinations: []Capability{
+			{Name: DestMQTT, Parameters: mqttParameters},
+			{Name: DestRest, Parameters: restParameters},
+			{Name: DestInfluxDB, Parameters: influxDBParameters},
+		},
+		Filters: []Capability{
+			{Name: FilterDevice, Parameters: []Parameter{{Field: "filter.deviceIdentifiers"}}},
+			{Name: FilterValueDescriptor, Parameters: []Parameter{{Field: "filter.valueDescriptorIdentifiers"}}},
+		},
+	}
+}
+
+// Names - names of the capabilities
+func Names(caps []Capability) []string {
+	names := make([]string, len(caps))
+	for i, c := range caps {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func findCapability(caps []Capability, name string) *Capability {
+	for i := range caps {
+		if caps[i].Name == name {
+			return &caps[i]
+		}
+	}
+	return nil
+}
+
+// isZero - check if a field of the JSON document is unset
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// validateParameters - check the fields of the registration configuring c
+func validateParameters(c *Capability, fields map[string]interface{}, errs *ValidationError) {
+	for _, p := range c.Parameters {
+		v := fields[p.Field]
+		if n, ok := v.(float64); ok && p.Max > 0 && (n < float64(p.Min) || n > float64(p.Max)) {
+			errs.add(p.Field, CodeOutOfRange, p.Field+" must be between "+
+				strconv.Itoa(p.Min)+" and "+strconv.Itoa(p.Max))
+			continue
+		}
+
+		if isZero(v) {
+			if p.Required {
+				errs.add(p.Field, CodeRequired, p.Field+" is required for "+c.Name)
+			}
+			continue
+		}
+
+		if s, _ := v.(string); len(p.Values) > 0 && !contains(p.Values, s) {
+			errs.add(p.Field, CodeInvalid, "unknown "+p.Field+" "+s+", expected one of "+
+				strings.Join(p.Values, ", "))
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsField - check if one of caps is configured by field
+func supportsField(caps []Capability, field string) bool {
+	for _, c := range caps {
+		for _, p := range c.Parameters {
+			if p.Field == field {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+// Number of audit entries kept in memory, older ones are only in the log
+const auditLogSize = 1000
+
+// AuditEntry - registration change made through the API
+type AuditEntry struct {
+	Time         int64  `json:"time"`
+	User         string `json:"user"`
+	Role         string `json:"role"`
+	Remote       string `json:"remote"`
+	Operation    string `json:"operation"`
+	Registration string `json:"registration"`
+	NewName      string `json:"newName,omitempty"`
+}
+
+var auditLog = struct {
+	sync.Mutex
+	entries []AuditEntry
+}{}
+
+// registrationChanged - audit a registration change made by r, store it in
+// the history and notify it. before is nil for additions and after is nil
+// for deletions
+func registrationChanged(r *http.Request, update export.NotifyUpdate, before, after *export.Registration) {
+	changedBy(principal(r), r.RemoteAddr, update, before, after)
+}
+
+// changedBy - registrationChanged for changes not made through the API
+func changedBy(p *Principal, remote string, update export.NotifyUpdate, before, after *export.Registration) {
+	entry := AuditEntry{
+		Time:         time.Now().UnixNano() / int64(time.Millisecond),
+		User:         p.Name,
+		Role:         p.Role,
+		Remote:       remote,
+		Operation:    update.Operation,
+		Registration: update.Name,
+		NewName:      update.NewName,
+	}
+
+	logger.Info("Audit", zap.String("user", entry.User), zap.String("role", entry.Role),
+		zap.String("remote", entry.Remote), zap.String("operation", entry.Operation),
+		zap.String("registration", entry.Registration), zap.String("newName", entry.NewName))
+
+	auditLog.Lock()
+	auditLog.entries = append(auditLog.entries, entry)
+	if len(auditLog.entries) > auditLogSize {
+		auditLog.entries = auditLog.entries[len(auditLog.entries)-auditLogSize:]
+	}
+	auditLog.Unlock()
+
+	recordVersion(p, entry.Time, update.Operation, before, after)
+	notifyUpdatedRegistrations(update)
+}
+
+func getAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	auditLog.Lock()
+	entries := append([]AuditEntry{}, auditLog.entries...)
+	auditLog.Unlock()
+
+	res, err := json.Marshal(entries)
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(res))
+}
@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Roles, every role is granted the permissions of the previous ones.
+// RoleInternal is the role of export-distro: it has the permissions of
+// RoleViewer and can read the registrations with their secrets
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+	RoleInternal = "internal"
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+	RoleInternal: 1,
+}
+
+const apiKeyHeader = "X-API-Key"
+
+var (
+	errUnauthorized = errors.New("invalid credentials")
+	errInvalidRole  = errors.New("invalid role")
+)
+
+// Principal - authenticated caller of the API
+type Principal struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// anonymous - principal of every request when authentication is disabled
+var anonymous = &Principal{Name: "anonymous", Role: RoleAdmin}
+
+// Authenticator - request authentication method. Authenticate returns nil
+// and no error if the request has no credentials for the method, and an
+// error if it has invalid ones
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthConfig - files with the credentials of each authentication method,
+// methods without a file are disabled
+type AuthConfig struct {
+	APIKeysFile  string
+	HMACKeysFile string
+	JWKSFile     string
+	JWTIssuer    string
+	JWTAudience  string
+}
+
+// Credential - API key or HMAC secret of a principal, as stored in the
+// credential files
+type Credential struct {
+	Principal
+	Key string `json:"key"`
+}
+
+var authenticators []Authenticator
+
+type principalKey struct{}
+
+// InitAuth - load the authenticators enabled in the config. Without any
+// authenticator every request is handled as an anonymous admin
+func InitAuth(config AuthConfig) error {
+	authenticators = nil
+
+	if config.APIKeysFile != "" {
+		creds, err := loadCredentials(config.APIKeysFile)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, newAPIKeyAuthenticator(creds))
+	}
+
+	if config.HMACKeysFile != "" {
+		creds, err := loadCredentials(config.HMACKeysFile)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, newHMACAuthenticator(creds))
+	}
+
+	if config.JWKSFile != "" {
+		a, err := newJWTAuthenticator(config.JWKSFile, config.JWTIssuer, config.JWTAudience)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, a)
+	}
+
+	if len(authenticators) == 0 {
+		logger.Warn("Authentication disabled, all requests have admin role")
+	}
+	return nil
+}
+
+func loadCredentials(path string) ([]Credential, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := []Credential{}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	for _, c := range creds {
+		if _, ok := roleLevels[c.Role]; !ok || c.Key == "" {
+			return nil, errInvalidRole
+		}
+	}
+	return creds, nil
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+	if len(authenticators) == 0 {
+		return anonymous, nil
+	}
+
+	for _, a := range authenticators {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, errUnauthorized
+}
+
+// authorize - only call h for requests authenticated with at least role
+func authorize(role string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := authenticate(r)
+		if err != nil {
+			logger.Warn("Unauthorized request", zap.String("url", r.URL.String()),
+				zap.String("remote", r.RemoteAddr), zap.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="export-client"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, err.Error())
+			return
+		}
+
+		if !granted(p, role) {
+			logger.Warn("Forbidden request", zap.String("url", r.URL.String()),
+				zap.String("user", p.Name), zap.String("role", p.Role))
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "Role "+role+" required")
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// granted - whether p has the permissions of role. RoleInternal is only
+// granted to itself and to RoleAdmin
+func granted(p *Principal, role string) bool {
+	if role == RoleInternal {
+		return p.Role == RoleInternal || p.Role == RoleAdmin
+	}
+	return roleLevels[p.Role] >= roleLevels[role]
+}
+
+// principal - caller of an authorized request
+func principal(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return anonymous
+}
+
+// apiKeyAuthenticator - keys are indexed by their hash, so lookups do not
+// leak the keys through timing
+type apiKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+func newAPIKeyAuthenticator(creds []Credential) Authenticator {
+	a := apiKeyAuthenticator{keys: make(map[[sha256.Size]byte]Principal)}
+	for _, c := range creds {
+		a.keys[sha256.Sum256([]byte(c.Key))] = c.Principal
+	}
+	return a
+}
+
+// Authenticate - static API key sent in the X-API-Key header or as
+// "Authorization: ApiKey <key>"
+func (a apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "ApiKey ") {
+		key = strings.TrimPrefix(auth, "ApiKey ")
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, errUnauthorized
+	}
+	return &p, nil
+}
@@ -0,0 +1,265 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, sum[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func writeTempFile(t *testing.T, dir, name string, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthorize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("jwt-secret")
+
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kty": "oct", "kid": "oct", "k": b64(secret)},
+	}}
+	keys := []Credential{
+		{Principal{"viewer", RoleViewer}, "viewer-key"},
+		{Principal{"admin", RoleAdmin}, "admin-key"},
+	}
+
+	err = InitAuth(AuthConfig{
+		APIKeysFile:  writeTempFile(t, dir, "keys.json", keys),
+		HMACKeysFile: writeTempFile(t, dir, "hmac.json", []Credential{{Principal{"op", RoleOperator}, "hmac-secret"}}),
+		JWKSFile:     writeTempFile(t, dir, "jwks.json", jwks),
+		JWTIssuer:    "issuer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { authenticators = nil }()
+
+	var caller *Principal
+	h := authorize(RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		caller = principal(r)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := func(role string) map[string]interface{} {
+		return map[string]interface{}{"sub": "jwt-user", "iss": "issuer", "exp": exp, "role": role}
+	}
+	hmacRequest := func(secret string, date time.Time) *http.Request {
+		body := []byte(`{"name":"reg"}`)
+		r := httptest.NewRequest("POST", "/api/v1/registration?a=b", bytes.NewReader(body))
+		r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+		r.Header.Set("Authorization", "HMAC op:"+HMACSignature(r, body, secret))
+		return r
+	}
+
+	cases := []struct {
+		header string
+		value  string
+		code   int
+		user   string
+	}{
+		{"", "", http.StatusUnauthorized, ""},
+		{apiKeyHeader, "unknown", http.StatusUnauthorized, ""},
+		{apiKeyHeader, "viewer-key", http.StatusForbidden, ""},
+		{apiKeyHeader, "admin-key", http.StatusOK, "admin"},
+		{"Authorization", "ApiKey admin-key", http.StatusOK, "admin"},
+		{"Authorization", "Bearer " + signJWT(t, "RS256", "rsa", rsaKey, claims(RoleOperator)), http.StatusOK, "jwt-user"},
+		{"Authorization", "Bearer " + signJWT(t, "ES256", "ec", ecKey, claims(RoleAdmin)), http.StatusOK, "jwt-user"},
+		{"Authorization", "Bearer " + signJWT(t, "HS256", "oct", secret, claims(RoleOperator)), http.StatusOK, "jwt-user"},
+		{"Authorization", "Bearer " + signJWT(t, "RS256", "rsa", rsaKey, claims(RoleViewer)), http.StatusForbidden, ""},
+		// algorithm not matching the key
+		{"Authorization", "Bearer " + signJWT(t, "HS256", "rsa", secret, claims(RoleAdmin)), http.StatusUnauthorized, ""},
+		{"Authorization", "Bearer " + signJWT(t, "RS256", "rsa", rsaKey, map[string]interface{}{
+			"sub": "jwt-user", "iss": "issuer", "exp": time.Now().Add(-time.Hour).Unix(), "role": RoleAdmin}),
+			http.StatusUnauthorized, ""},
+		{"Authorization", "Bearer " + signJWT(t, "RS256", "rsa", rsaKey, map[string]interface{}{
+			"sub": "jwt-user", "iss": "other", "exp": exp, "role": RoleAdmin}),
+			http.StatusUnauthorized, ""},
+		{"Authorization", "Bearer a.b.c", http.StatusUnauthorized, ""},
+	}
+
+	for i, c := range cases {
+		caller = nil
+		r := httptest.NewRequest("GET", "/api/v1/registration", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, w.Code)
+		}
+		if c.user != "" && (caller == nil || caller.Name != c.user) {
+			t.Errorf("case %d: expected caller %s got %v", i+1, c.user, caller)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, hmacRequest("hmac-secret", time.Now()))
+	if w.Code != http.StatusOK || caller.Name != "op" {
+		t.Fatal("HMAC request should be accepted", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "reg") {
+		t.Fatal("Body should be available after HMAC authentication")
+	}
+
+	for _, r := range []*http.Request{
+		hmacRequest("wrong", time.Now()),
+		hmacRequest("hmac-secret", time.Now().Add(-time.Hour)),
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatal("HMAC request should be rejected", w.Code)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = doRequest("DELETE", "/api/v1/registration/name/reg1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = doRequest("GET", "/api/v1/audit", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []AuditEntry{}
+	err = json.NewDecoder(res.Body).Decode(&entries)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(entries)
+	if n < 2 || entries[n-2].Operation != "add" || entries[n-1].Operation != "delete" ||
+		entries[n-1].Registration != "reg1" || entries[n-1].User != anonymous.Name {
+		t.Fatal("Unexpected audit entries", entries)
+	}
+}
+
+func TestInternalRole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := []Credential{
+		{Principal{"distro", RoleInternal}, "internal-key"},
+		{Principal{"viewer", RoleViewer}, "viewer-key"},
+		{Principal{"operator", RoleOperator}, "operator-key"},
+	}
+	err = InitAuth(AuthConfig{APIKeysFile: writeTempFile(t, dir, "keys.json", keys)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { authenticators = nil }()
+
+	cases := []struct {
+		method string
+		url    string
+		key    string
+		code   int
+	}{
+		{"GET", "/api/v1/internal/registration", "internal-key", http.StatusOK},
+		{"GET", "/api/v1/registration", "internal-key", http.StatusOK},
+		{"POST", "/api/v1/registration", "internal-key", http.StatusForbidden},
+		{"DELETE", "/api/v1/registration/name/reg1", "internal-key", http.StatusForbidden},
+		{"GET", "/api/v1/audit", "internal-key", http.StatusForbidden},
+		{"GET", "/api/v1/internal/registration", "viewer-key", http.StatusForbidden},
+		{"GET", "/api/v1/internal/registration", "operator-key", http.StatusForbidden},
+	}
+
+	for i, c := range cases {
+		req, _ := http.NewRequest(c.method, ts.URL+c.url, strings.NewReader(validReg))
+		req.Header.Set(apiKeyHeader, c.key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+}
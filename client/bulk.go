@@ -0,0 +1,385 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/drasko/edgex-export"
+	"github.com/ghodss/yaml"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const mimeTypeYAML = "application/yaml"
+
+// Import modes for registrations that already exist
+const (
+	importSkip      = "skip"
+	importOverwrite = "overwrite"
+	importFail      = "fail"
+)
+
+// Import actions
+const (
+	actionCreate    = "create"
+	actionUpdate    = "update"
+	actionSkip      = "skip"
+	actionUnchanged = "unchanged"
+	actionDelete    = "delete"
+)
+
+// importConflictError - names of the registrations that would be changed
+// by an import in fail mode
+type importConflictError []string
+
+func (e importConflictError) Error() string {
+	return "registrations already exist: " + strings.Join(e, ", ")
+}
+
+// ImportResult - action taken, or to take in a dry run, for each imported
+// registration
+type ImportResult struct {
+	DryRun        bool           `json:"dryRun"`
+	Mode          string         `json:"mode"`
+	Registrations []ImportAction `json:"registrations"`
+}
+
+// ImportAction - action for an imported registration, with the fields it
+// changes
+type ImportAction struct {
+	Name    string               `json:"name"`
+	Action  string               `json:"action"`
+	Changes []export.FieldChange `json:"changes,omitempty"`
+
+	old *export.Registration
+	reg export.Registration
+}
+
+// wantsYAML - check if the reply to r should be YAML, set with the format
+// query parameter or the Accept header
+func wantsYAML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "yaml":
+		return true
+	case "json":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "yaml")
+}
+
+// writeDocument - reply with v as JSON or YAML
+func writeDocument(w http.ResponseWriter, r *http.Request, v interface{}) {
+	contentType := "application/json; charset=utf-8"
+	res, err := json.Marshal(v)
+	if err == nil && wantsYAML(r) {
+		contentType = mimeTypeYAML
+		res, err = yaml.JSONToYAML(res)
+	}
+	if err != nil {
+		logger.Error("Failed to generate document", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
+
+// exportReg - all registrations, sorted by name and without the fields set
+// by the client, so the document can be imported in other gateways. Secrets
+// are masked unless an admin asks for them with secrets=true
+func exportReg(w http.ResponseWriter, r *http.Request) {
+	secrets := false
+	if v := r.URL.Query().Get("secrets"); v != "" {
+		var err error
+		if secrets, err = strconv.ParseBool(v); err != nil {
+			logger.Error("Invalid secrets", zap.String("secrets", v))
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Invalid secrets: "+v)
+			return
+		}
+	}
+	if secrets && !granted(principal(r), RoleAdmin) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "Role "+RoleAdmin+" required to export secrets")
+		return
+	}
+
+	regs, _, err := repo.Registrations(export.RegistrationQuery{Sort: export.SortName})
+	if err != nil {
+		logger.Error("Failed to query all registrations", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	for i := range regs {
+		regs[i].ID = ""
+		regs[i].Created = 0
+		regs[i].Modified = 0
+		regs[i].ManagedBy = ""
+		if !secrets {
+			redactSecrets(&regs[i])
+		}
+	}
+
+	writeDocument(w, r, export.RegistrationDocument{Registrations: regs})
+}
+
+// parseDocument - read a registration document in JSON or YAML
+func parseDocument(data []byte) (export.RegistrationDocument, error) {
+	doc := export.RegistrationDocument{}
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return doc, err
+	}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// planImport - validate the document and decide the action for each of its
+// registrations. Masked secrets keep the stored ones
+func planImport(doc export.RegistrationDocument, mode string) ([]ImportAction, error) {
+	var errs export.ValidationError
+	names := make(map[string]bool)
+	actions := []ImportAction{}
+	var existing importConflictError
+
+	caps := currentCapabilities()
+	for i, reg := range doc.Registrations {
+		prefix := fmt.Sprintf("registrations[%d].", i)
+		if names[reg.Name] {
+			errs = append(errs, export.FieldError{
+				Field:   prefix + "name",
+				Code:    export.CodeInvalid,
+				Message: "duplicate name " + reg.Name,
+			})
+		}
+		names[reg.Name] = true
+
+		action := ImportAction{Name: reg.Name, Action: actionCreate}
+		old, err := repo.RegistrationByName(reg.Name)
+		switch err {
+		case nil:
+			if old.FileManaged() && !reg.FileManaged() {
+				errs = append(errs, export.FieldError{
+					Field:   prefix + "name",
+					Code:    export.CodeInvalid,
+					Message: "registration " + reg.Name + " is managed by " + old.ManagedBy,
+				})
+				continue
+			}
+			keepSecrets(old, &reg)
+			action.old = &old
+		case export.ErrNotFound:
+			err = maskedSecrets(reg)
+		default:
+			return nil, err
+		}
+		if err == nil {
+			err = reg.ValidateWith(caps)
+		}
+		if fields, ok := err.(export.ValidationError); ok {
+			for _, f := range fields {
+				f.Field = prefix + f.Field
+				errs = append(errs, f)
+			}
+			continue
+		}
+
+		reg.ID = ""
+		reg.Created = 0
+		if action.old != nil {
+			reg.ID = old.ID
+			reg.Created = old.Created
+			changes, err := export.DiffRegistrations(old, reg)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case len(changes) == 0:
+				action.Action = actionUnchanged
+			case mode == importSkip:
+				action.Action = actionSkip
+			default:
+				action.Action = actionUpdate
+				existing = append(existing, reg.Name)
+			}
+			action.Changes = maskChanges(changes)
+		}
+		action.reg = reg
+		actions = append(actions, action)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if mode == importFail && len(existing) > 0 {
+		return nil, existing
+	}
+	return actions, nil
+}
+
+// applyImport - store the planned changes. If a change fails, the changes
+// already stored are reverted, so the import is applied as a whole or not
+// at all
+func applyImport(actions []ImportAction) error {
+	for i := range actions {
+		a := &actions[i]
+		var err error
+		switch a.Action {
+		case actionCreate:
+			a.reg.Modified = nextModified(0)
+			a.reg.Created = a.reg.Modified
+			var id string
+			if id, err = repo.AddRegistration(a.reg); err == nil {
+				a.reg.ID = bson.ObjectIdHex(id)
+			}
+		case actionUpdate:
+			a.reg.Modified = nextModified(a.old.Modified)
+			err = repo.UpdateRegistration(a.reg, a.old.Modified)
+		case actionDelete:
+			err = repo.DeleteRegistrationByID(a.old.ID.Hex())
+		default:
+			continue
+		}
+
+		if err != nil {
+			revertImport(actions[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+func revertImport(applied []ImportAction) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		var err error
+		switch a.Action {
+		case actionCreate:
+			err = repo.DeleteRegistrationByID(a.reg.ID.Hex())
+		case actionUpdate:
+			err = repo.UpdateRegistration(*a.old, a.reg.Modified)
+		case actionDelete:
+			_, err = repo.AddRegistration(*a.old)
+		}
+		if err != nil {
+			logger.Error("Failed to revert import", zap.String("name", a.Name), zap.Error(err))
+		}
+	}
+}
+
+// importReg - create or update the registrations of a JSON or YAML
+// document. mode sets what happens with registrations that already exist
+// and differ: skip them, overwrite them or fail the import (the default).
+// With dryRun=true the actions are returned without applying them
+func importReg(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	mode := query.Get("mode")
+	switch mode {
+	case "":
+		mode = importFail
+	case importSkip, importOverwrite, importFail:
+	default:
+		logger.Error("Invalid import mode", zap.String("mode", mode))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Invalid mode: "+mode)
+		return
+	}
+
+	dryRun := false
+	if v := query.Get("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			logger.Error("Invalid dryRun", zap.String("dryRun", v))
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Invalid dryRun: "+v)
+			return
+		}
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed to read import", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		logger.Error("Failed to parse import", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Only the registration files can set registrations as file managed
+	for i := range doc.Registrations {
+		doc.Registrations[i].ManagedBy = ""
+	}
+
+	actions, err := planImport(doc, mode)
+	if err != nil {
+		logger.Error("Failed to plan import", zap.Error(err))
+		status := http.StatusInternalServerError
+		switch err.(type) {
+		case export.ValidationError:
+			status = http.StatusBadRequest
+		case importConflictError:
+			status = http.StatusConflict
+		}
+		writeProblem(w, status, err)
+		return
+	}
+
+	result := ImportResult{DryRun: dryRun, Mode: mode, Registrations: actions}
+	if dryRun {
+		writeDocument(w, r, result)
+		return
+	}
+
+	if err := applyImport(actions); err != nil {
+		logger.Error("Failed to import registrations", zap.Error(err))
+		status := repoErrorStatus(err)
+		if err == export.ErrDuplicateName {
+			status = http.StatusConflict
+		}
+		writeProblem(w, status, err)
+		return
+	}
+
+	writeDocument(w, r, result)
+	importChanged(principal(r), r.RemoteAddr, actions)
+}
+
+// importChanged - audit, record and notify the applied import actions
+func importChanged(p *Principal, remote string, actions []ImportAction) {
+	for i := range actions {
+		a := &actions[i]
+		switch a.Action {
+		case actionCreate:
+			changedBy(p, remote, export.NotifyUpdate{Name: a.Name, Operation: export.NotifyUpdateAdd},
+				nil, &a.reg)
+		case actionUpdate:
+			changedBy(p, remote, export.NotifyUpdate{Name: a.Name, Operation: export.NotifyUpdateUpdate},
+				a.old, &a.reg)
+		case actionDelete:
+			changedBy(p, remote, export.NotifyUpdate{Name: a.Name, Operation: export.NotifyUpdateDelete},
+				a.old, nil)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+const importDoc = `
+registrations:
+- name: bulk1
+  format: JSON
+  destination: MQTT_TOPIC
+  addressable:
+    Address: 127.0.0.1
+    Port: 1883
+    Topic: topic
+    Password: pass
+- name: bulk2
+  format: XML
+  destination: REST_ENDPOINT
+  addressable:
+    Address: 127.0.0.1
+    Port: 8080
+    Method: POST
+`
+
+func importRequest(t *testing.T, query, body string) (int, ImportResult) {
+	res, err := doRequest("POST", "/api/v1/registration/import"+query, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	result := ImportResult{}
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode, result
+}
+
+func actions(result ImportResult) string {
+	list := []string{}
+	for _, a := range result.Registrations {
+		list = append(list, a.Name+":"+a.Action)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestImportExport(t *testing.T) {
+	defer doRequest("DELETE", "/api/v1/registration/name/bulk1", "")
+	defer doRequest("DELETE", "/api/v1/registration/name/bulk2", "")
+
+	code, result := importRequest(t, "?dryRun=true", importDoc)
+	if code != http.StatusOK || !result.DryRun || actions(result) != "bulk1:create,bulk2:create" {
+		t.Fatal("Unexpected dry run", code, result)
+	}
+	if _, err := repo.RegistrationByName("bulk1"); err != export.ErrNotFound {
+		t.Fatal("Dry run should not store registrations")
+	}
+
+	code, result = importRequest(t, "", importDoc)
+	if code != http.StatusOK || actions(result) != "bulk1:create,bulk2:create" {
+		t.Fatal("Unexpected import", code, result)
+	}
+
+	// Export and import back the masked document
+	res, err := doRequest("GET", "/api/v1/registration/export?format=yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.Header.Get("Content-Type") != mimeTypeYAML || !strings.Contains(string(data), "Password: '******'") {
+		t.Fatal("Unexpected export", string(data))
+	}
+	code, result = importRequest(t, "", string(data))
+	if code != http.StatusOK || actions(result) != "bulk1:unchanged,bulk2:unchanged" {
+		t.Fatal("Export should import unchanged", code, result)
+	}
+
+	changed := strings.Replace(importDoc, "Port: 8080", "Port: 8081", 1)
+	if code, _ = importRequest(t, "", changed); code != http.StatusConflict {
+		t.Fatal("Import of existing registrations should fail", code)
+	}
+	code, result = importRequest(t, "?mode=skip", changed)
+	if code != http.StatusOK || actions(result) != "bulk1:unchanged,bulk2:skip" {
+		t.Fatal("Unexpected skip import", code, result)
+	}
+	code, result = importRequest(t, "?mode=overwrite", changed)
+	if code != http.StatusOK || actions(result) != "bulk1:unchanged,bulk2:update" ||
+		result.Registrations[1].Changes[0].Field != "addressable.Port" {
+		t.Fatal("Unexpected overwrite import", code, result)
+	}
+	if reg, _ := repo.RegistrationByName("bulk2"); reg.Addressable.Port != 8081 {
+		t.Fatal("Registration was not overwritten", reg)
+	}
+	if reg, _ := repo.RegistrationByName("bulk1"); reg.Addressable.Password != "pass" {
+		t.Fatal("Masked secret should be kept", reg)
+	}
+
+	invalid := []string{
+		"registrations: [",
+		strings.Replace(importDoc, "bulk2", "bulk1", 1),
+		strings.Replace(importDoc, "XML", "WRONG", 1),
+		strings.Replace(importDoc, "    Topic: topic\n", "", 1),
+		"?mode=all",
+	}
+	for i, body := range invalid {
+		query := "?mode=overwrite"
+		if strings.HasPrefix(body, "?") {
+			query, body = body, importDoc
+		}
+		if code, _ := importRequest(t, query, body); code == http.StatusOK {
+			t.Errorf("case %d: invalid import should fail", i+1)
+		}
+	}
+
+	if reg, _ := repo.RegistrationByName("bulk2"); reg.Format != export.FormatXML {
+		t.Fatal("Failed import should not change registrations", reg)
+	}
+}
+
+func TestImportAtomic(t *testing.T) {
+	// The second registration is taken by a rename after planning, so
+	// adding it fails and the first one must be removed
+	actions := []ImportAction{
+		{Name: "atomic1", Action: actionCreate, reg: export.Registration{Name: "atomic1"}},
+		{Name: "atomic2", Action: actionCreate, reg: export.Registration{Name: "atomic2"}},
+	}
+	if _, err := repo.AddRegistration(export.Registration{Name: "atomic2"}); err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteRegistrationByName("atomic2")
+
+	if err := applyImport(actions); err != export.ErrDuplicateName {
+		t.Fatal("Expected duplicate name error got", err)
+	}
+	if _, err := repo.RegistrationByName("atomic1"); err != export.ErrNotFound {
+		t.Fatal("Applied changes should be reverted")
+	}
+}
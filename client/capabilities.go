@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+const (
+	// Time the capabilities read from distro are kept
+	capabilitiesTTL = time.Minute
+	// Time allowed to distro to reply with its capabilities
+	capabilitiesTimeout = 2 * time.Second
+)
+
+var distroCapabilities = struct {
+	sync.Mutex
+	caps    export.Capabilities
+	fetched time.Time
+}{}
+
+func fetchCapabilities() (export.Capabilities, error) {
+	caps := export.Capabilities{}
+	client := &http.Client{Timeout: capabilitiesTimeout}
+	response, err := client.Get(distroURL("/api/v1/capabilities"))
+	if err != nil {
+		return caps, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return caps, errors.New("unexpected status " + response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&caps)
+	return caps, err
+}
+
+// currentCapabilities - capabilities of distro, read again once older than
+// capabilitiesTTL. If distro can not be reached the last ones read are
+// kept, or DefaultCapabilities until distro replies
+func currentCapabilities() export.Capabilities {
+	distroCapabilities.Lock()
+	defer distroCapabilities.Unlock()
+
+	if !distroCapabilities.fetched.IsZero() && time.Since(distroCapabilities.fetched) < capabilitiesTTL {
+		return distroCapabilities.caps
+	}
+
+	caps, err := fetchCapabilities()
+	switch {
+	case err == nil:
+		distroCapabilities.caps = caps
+	case distroCapabilities.fetched.IsZero():
+		logger.Warn("Failed to read distro capabilities, using the defaults", zap.Error(err))
+		distroCapabilities.caps = export.DefaultCapabilities()
+	default:
+		logger.Warn("Failed to read distro capabilities, keeping the last ones", zap.Error(err))
+	}
+	distroCapabilities.fetched = time.Now()
+	return distroCapabilities.caps
+}
+
+func getCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	res, err := json.Marshal(currentCapabilities())
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(res))
+}
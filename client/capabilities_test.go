@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drasko/edgex-export"
+)
+
+func resetCapabilities() {
+	distroCapabilities.Lock()
+	distroCapabilities.fetched = time.Time{}
+	distroCapabilities.Unlock()
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := export.DefaultCapabilities()
+	caps.Formats = []export.Capability{{Name: export.FormatJSON}}
+	distro := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(caps)
+	}))
+	defer distro.Close()
+
+	host, port, _ := net.SplitHostPort(distro.Listener.Addr().String())
+	saved := cfg
+	defer func() {
+		cfg = saved
+		resetCapabilities()
+	}()
+	cfg.DistroHost = host
+	cfg.DistroPort, _ = strconv.Atoi(port)
+	resetCapabilities()
+
+	formats := []string{}
+	getJSON(t, "/api/v1/registration/reference/formats", &formats)
+	if len(formats) != 1 || formats[0] != export.FormatJSON {
+		t.Fatal("Formats should come from distro", formats)
+	}
+
+	filters := []string{}
+	getJSON(t, "/api/v1/registration/reference/filters", &filters)
+	if len(filters) != len(caps.Filters) {
+		t.Fatal("Unexpected filters", filters)
+	}
+
+	reg := strings.Replace(validReg, `"name":"reg1","format":"JSON"`, `"name":"caps","format":"XML"`, 1)
+	res, err := doRequest("POST", "/api/v1/registration", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatal("Format not supported by distro should be rejected", res.StatusCode)
+	}
+
+	// Unreachable distro keeps the last capabilities read
+	distro.Close()
+	distroCapabilities.Lock()
+	distroCapabilities.fetched = time.Now().Add(-capabilitiesTTL)
+	distroCapabilities.Unlock()
+	if got := currentCapabilities(); len(got.Formats) != 1 {
+		t.Fatal("Last capabilities should be kept", got.Formats)
+	}
+}
@@ -10,11 +10,18 @@ package client
 const (
 	defaultPort       = 48071
 	defaultDistroHost = "127.0.0.1"
+	defaultDistroPort = 48070
 )
 
 type Config struct {
 	Port       int
 	DistroHost string
+	DistroPort int
+	// Push registration changes to distro in addition to the change feed
+	NotifyDistro bool
+	Auth         AuthConfig
+	// Directory with file managed registrations, not watched if empty
+	RegistrationDir string
 }
 
 var cfg Config
@@ -23,5 +30,6 @@ func GetDefaultConfig() Config {
 	return Config{
 		Port:       defaultPort,
 		DistroHost: defaultDistroHost,
+		DistroPort: defaultDistroPort,
 	}
 }
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-zoo/bone"
+	"go.uber.org/zap"
+)
+
+// Time allowed to distro to run a connectivity test, which has a timeout
+// for each of its steps
+const connectivityTimeout = time.Minute
+
+// testReg - ask distro to open a connection with the destination of a
+// registration, with the sender distro would use. Distro loads the stored
+// registration by name. The reply is the result of the test. The probe
+// query parameter sets the method of the probe request of REST
+// destinations: OPTIONS (the default), HEAD or POST
+func testReg(w http.ResponseWriter, r *http.Request) {
+	name := bone.GetValue(r, "name")
+
+	if _, err := repo.RegistrationByName(name); err != nil {
+		logger.Error("Failed to query by name", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	req := struct {
+		Name  string `json:"name"`
+		Probe string `json:"probe,omitempty"`
+	}{name, r.URL.Query().Get("probe")}
+	data, err := json.Marshal(req)
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	client := &http.Client{Timeout: connectivityTimeout}
+	response, err := client.Post(distroURL("/api/v1/test"), "application/json", bytes.NewReader(data))
+	replyFromDistro(w, response, err)
+}
+
+// replyFromDistro - forward the reply of distro to a request, replying
+// with bad gateway if distro could not be reached
+func replyFromDistro(w http.ResponseWriter, response *http.Response, err error) {
+	if err != nil {
+		logger.Error("Failed to reach distro", zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, err.Error())
+		return
+	}
+	defer response.Body.Close()
+
+	res, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		logger.Error("Failed to read distro reply", zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", response.Header.Get("Content-Type"))
+	w.WriteHeader(response.StatusCode)
+	w.Write(res)
+}
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+func TestTestReg(t *testing.T) {
+	var sent map[string]interface{}
+	distro := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"registration":"conn","success":false,"cause":"auth"}`)
+	}))
+	defer distro.Close()
+
+	host, port, _ := net.SplitHostPort(distro.Listener.Addr().String())
+	saved := cfg
+	defer func() { cfg = saved }()
+	cfg.DistroHost = host
+	cfg.DistroPort, _ = strconv.Atoi(port)
+
+	reg := export.Registration{
+		Name:        "conn",
+		Format:      export.FormatJSON,
+		Destination: export.DestRest,
+		Addressable: export.Addressable{Address: "http://127.0.0.1", Port: 8080, Method: "POST", Password: "pass"},
+	}
+	if _, err := repo.AddRegistration(reg); err != nil {
+		t.Fatal(err)
+	}
+	defer repo.DeleteRegistrationByName("conn")
+
+	res, err := doRequest("POST", "/api/v1/registration/conn/test?probe=HEAD", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := export.ConnectivityResult{}
+	json.NewDecoder(res.Body).Decode(&result)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || result.Cause != export.CauseAuth {
+		t.Fatal("Unexpected reply", res.StatusCode, result)
+	}
+	// Distro loads the registration, with its secrets, by name
+	if sent["name"] != "conn" || sent["probe"] != "HEAD" || sent["registration"] != nil {
+		t.Fatal("Unexpected test request", sent)
+	}
+
+	if res, _ = doRequest("POST", "/api/v1/registration/unknown/test", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatal("Unknown registration should not be found", res.StatusCode)
+	}
+
+	distro.Close()
+	if res, _ = doRequest("POST", "/api/v1/registration/conn/test", ""); res.StatusCode != http.StatusBadGateway {
+		t.Fatal("Unreachable distro should be a bad gateway", res.StatusCode)
+	}
+}
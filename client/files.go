@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"github.com/drasko/edgex-export"
+	"github.com/drasko/edgex-export/files"
+	"go.uber.org/zap"
+)
+
+// filePrincipal - author of the changes read from the registration files
+var filePrincipal = &Principal{Name: "files", Role: RoleAdmin}
+
+// reconcileFiles - make the stored file managed registrations match regs.
+// Registrations in regs are added or overwritten, also if they were added
+// through the API, and file managed registrations not in regs are deleted.
+// Like imports, the changes are stored as a whole or not at all
+func reconcileFiles(regs []export.Registration) ([]ImportAction, error) {
+	actions, err := planImport(export.RegistrationDocument{Registrations: regs}, importOverwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, _, err := repo.Registrations(export.RegistrationQuery{})
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, reg := range regs {
+		names[reg.Name] = true
+	}
+	for i := range stored {
+		if stored[i].FileManaged() && !names[stored[i].Name] {
+			actions = append(actions, ImportAction{
+				Name:   stored[i].Name,
+				Action: actionDelete,
+				old:    &stored[i],
+			})
+		}
+	}
+
+	if err := applyImport(actions); err != nil {
+		return nil, err
+	}
+	importChanged(filePrincipal, "", actions)
+	return actions, nil
+}
+
+// watchRegistrationDir - reconcile the registrations of the files in dir
+// every time they change, until done is closed
+func watchRegistrationDir(dir string, done chan struct{}) {
+	logger.Info("Watching registration files", zap.String("dir", dir))
+	files.Watch(dir, currentCapabilities, files.DefaultInterval, done, func(regs []export.Registration, err error) {
+		if err == nil {
+			_, err = reconcileFiles(regs)
+		}
+		if err != nil {
+			logger.Error("Failed to load registration files", zap.String("dir", dir), zap.Error(err))
+			return
+		}
+		logger.Info("Registration files loaded", zap.Int("registrations", len(regs)))
+	})
+}
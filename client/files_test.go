@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+func fileReg(name string, port int) export.Registration {
+	return export.Registration{
+		Name:        name,
+		Format:      export.FormatJSON,
+		Destination: export.DestRest,
+		Addressable: export.Addressable{Address: "127.0.0.1", Port: port, Method: export.MethodPost},
+		ManagedBy:   export.ManagedByFile + "gateway.yaml",
+	}
+}
+
+func TestReconcileFiles(t *testing.T) {
+	defer doRequest("DELETE", "/api/v1/registration/name/reg1", "")
+
+	// Registrations added through the API are taken over by the files
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	actions, err := reconcileFiles([]export.Registration{fileReg("file1", 5563), fileReg("reg1", 5563)})
+	if err != nil || actions[0].Action != actionCreate || actions[1].Action != actionUpdate {
+		t.Fatal("Unexpected reconcile", actions, err)
+	}
+
+	reg, err := repo.RegistrationByName("file1")
+	if err != nil || !reg.FileManaged() {
+		t.Fatal("Registration should be file managed", reg, err)
+	}
+	id := reg.ID.Hex()
+
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"GET", "/api/v1/registration/" + id, "", http.StatusOK},
+		{"PUT", "/api/v1/registration", `{"name":"file1","format":"XML"}`, http.StatusConflict},
+		{"PATCH", "/api/v1/registration/" + id, `{"format":"XML"}`, http.StatusConflict},
+		{"DELETE", "/api/v1/registration/" + id, "", http.StatusConflict},
+		{"DELETE", "/api/v1/registration/name/file1", "", http.StatusConflict},
+		{"POST", "/api/v1/registration/import?mode=overwrite", `{"registrations":[{"name":"file1",` +
+			`"format":"XML","destination":"REST_ENDPOINT","addressable":{"Address":"a","Port":1,"Method":"POST"}}]}`,
+			http.StatusUnprocessableEntity},
+		// The API can not set registrations as file managed
+		{"POST", "/api/v1/registration", strings.Replace(validReg, `"name":"reg1"`,
+			`"name":"api","managedBy":"file:gateway.yaml"`, 1), http.StatusCreated},
+		{"DELETE", "/api/v1/registration/name/api", "", http.StatusOK},
+	}
+
+	for i, c := range cases {
+		res, err := doRequest(c.method, c.url, c.body)
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+
+	actions, err = reconcileFiles([]export.Registration{fileReg("reg1", 5564)})
+	if err != nil || len(actions) != 2 || actions[0].Action != actionUpdate || actions[1].Action != actionDelete {
+		t.Fatal("Unexpected reconcile", actions, err)
+	}
+	if _, err := repo.RegistrationByName("file1"); err != export.ErrNotFound {
+		t.Fatal("Registration removed from the files should be deleted", err)
+	}
+
+	if _, err := reconcileFiles(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RegistrationByName("reg1"); err != export.ErrNotFound {
+		t.Fatal("Registration removed from the files should be deleted", err)
+	}
+}
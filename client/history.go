@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/drasko/edgex-export"
+	"github.com/go-zoo/bone"
+	"go.uber.org/zap"
+)
+
+// recordVersion - store the change from before to after as a new version.
+// before is nil for additions and after is nil for deletions. Secrets are
+// stored, encrypted as the registrations are, and masked in the replies
+func recordVersion(p *Principal, at int64, op string, before, after *export.Registration) {
+	if history == nil {
+		return
+	}
+
+	v := export.RegistrationVersion{
+		Time:      at,
+		User:      p.Name,
+		Operation: op,
+	}
+
+	var snapshot export.Registration
+	switch {
+	case after == nil:
+		snapshot = *before
+	case before == nil:
+		snapshot = *after
+		before = &export.Registration{}
+	default:
+		snapshot = *after
+	}
+	v.RegistrationID = snapshot.ID
+
+	if after != nil {
+		changes, err := export.DiffRegistrations(*before, *after)
+		if err != nil {
+			logger.Error("Failed to diff registration", zap.Error(err))
+			return
+		}
+		v.Changes = maskChanges(changes)
+	}
+
+	v.Registration = &snapshot
+
+	if _, err := history.AddVersion(v); err != nil {
+		logger.Error("Failed to store registration version", zap.String("name", snapshot.Name),
+			zap.Error(err))
+	}
+}
+
+// versionParams - read the id and version path parameters, replying with
+// bad request if invalid
+func versionParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return "", 0, false
+	}
+
+	v := bone.GetValue(r, "version")
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Error("Invalid version", zap.String("version", v))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Invalid version: "+v)
+		return "", 0, false
+	}
+	return id, version, true
+}
+
+// getRegHistory - list the versions of a registration, without the
+// registration of each version
+func getRegHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return
+	}
+
+	versions, err := history.Versions(id)
+	if err != nil {
+		logger.Error("Failed to query history", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+	if len(versions) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, export.ErrNotFound.Error())
+		return
+	}
+
+	for i := range versions {
+		versions[i].Registration = nil
+	}
+
+	res, err := json.Marshal(versions)
+	if err != nil {
+		logger.Error("Failed to query history", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(res))
+}
+
+func getRegVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	id, version, ok := versionParams(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := history.Version(id, version)
+	if err != nil {
+		logger.Error("Failed to query version", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	redactSecrets(v.Registration)
+	res, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to query version", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(res))
+}
+
+// rollbackReg - restore the registration as it was in a version. Deleted
+// registrations are added again with the same ID and the secrets of the
+// version, the others keep their current secrets. The rollback is stored
+// as a new version and notified like any other change
+func rollbackReg(w http.ResponseWriter, r *http.Request) {
+	id, version, ok := versionParams(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := history.Version(id, version)
+	if err != nil {
+		logger.Error("Failed to query version", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	reg, err := repo.RegistrationByID(id)
+	switch err {
+	case nil:
+		redactSecrets(v.Registration)
+		applyUpdate(w, r, reg, *v.Registration)
+	case export.ErrNotFound:
+		createRegistration(w, r, *v.Registration)
+	default:
+		logger.Error("Failed to query by id", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestHistory(t *testing.T) {
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	id := string(data)
+	defer doRequest("DELETE", "/api/v1/registration/"+id, "")
+
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"PUT", "/api/v1/registration", `{"name":"reg1","addressable":{"Address":"10.0.0.1"}}`, http.StatusOK},
+		{"GET", "/api/v1/registration/" + id + "/history/2", "", http.StatusOK},
+		{"GET", "/api/v1/registration/" + id + "/history/3", "", http.StatusNotFound},
+		{"GET", "/api/v1/registration/" + id + "/history/x", "", http.StatusBadRequest},
+		{"GET", "/api/v1/registration/" + bson.NewObjectId().Hex() + "/history", "", http.StatusNotFound},
+		// Rollback to the added version
+		{"POST", "/api/v1/registration/" + id + "/history/1/rollback", "", http.StatusOK},
+		{"DELETE", "/api/v1/registration/name/reg1", "", http.StatusOK},
+		// Restore the deleted registration as it was updated
+		{"POST", "/api/v1/registration/" + id + "/history/2/rollback", "", http.StatusCreated},
+		{"POST", "/api/v1/registration/" + id + "/history/9/rollback", "", http.StatusNotFound},
+	}
+
+	for i, c := range cases {
+		res, err := doRequest(c.method, c.url, c.body)
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+
+	versions := []export.RegistrationVersion{}
+	getJSON(t, "/api/v1/registration/"+id+"/history", &versions)
+	ops := []string{}
+	for _, v := range versions {
+		ops = append(ops, v.Operation)
+	}
+	if len(versions) != 5 || versions[4].Operation != export.NotifyUpdateAdd ||
+		versions[3].Operation != export.NotifyUpdateDelete || versions[0].Registration != nil {
+		t.Fatal("Unexpected history", ops)
+	}
+
+	v := export.RegistrationVersion{}
+	getJSON(t, "/api/v1/registration/"+id+"/history/2", &v)
+	if len(v.Changes) != 1 || v.Changes[0].Field != "addressable.Address" ||
+		v.Changes[0].Old != "127.0.0.1" || v.Changes[0].New != "10.0.0.1" || v.User != anonymous.Name {
+		t.Fatal("Unexpected version", v)
+	}
+
+	reg := export.Registration{}
+	getJSON(t, "/api/v1/registration/"+id, &reg)
+	if reg.Addressable.Address != "10.0.0.1" {
+		t.Fatal("Registration was not restored", reg)
+	}
+}
@@ -0,0 +1,261 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const bearerScheme = "Bearer "
+
+// Leeway for the exp and nbf claims
+const jwtLeeway = time.Minute
+
+var errUnsupportedKey = errors.New("unsupported JWK")
+
+// jwk - JSON Web Key, only the members of RSA, EC P-256 and symmetric keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// jwtClaims - registered claims and the role of the caller, set in "role"
+// or as the highest role listed in "roles"
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	Role      string          `json:"role"`
+	Roles     []string        `json:"roles"`
+}
+
+// jwtKey - verification key for one algorithm
+type jwtKey struct {
+	alg string
+	key interface{}
+}
+
+type jwtAuthenticator struct {
+	keys     map[string]jwtKey
+	issuer   string
+	audience string
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) verificationKey() (jwtKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		return jwtKey{"RS256", &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return jwtKey{}, errUnsupportedKey
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		return jwtKey{"ES256", &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	case "oct":
+		secret, err := decodeSegment(k.K)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		return jwtKey{"HS256", secret}, nil
+	}
+	return jwtKey{}, errUnsupportedKey
+}
+
+// newJWTAuthenticator - verify tokens signed with the keys of a local JWKS
+// file. Supported algorithms are RS256, ES256 and HS256. Issuer and audience
+// are only checked if set
+func newJWTAuthenticator(path, issuer, audience string) (Authenticator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	a := jwtAuthenticator{
+		keys:     make(map[string]jwtKey),
+		issuer:   issuer,
+		audience: audience,
+	}
+	for _, k := range set.Keys {
+		key, err := k.verificationKey()
+		if err != nil {
+			return nil, err
+		}
+		if k.Alg != "" && k.Alg != key.alg {
+			return nil, errUnsupportedKey
+		}
+		a.keys[k.Kid] = key
+	}
+	return a, nil
+}
+
+func verifySignature(key jwtKey, signed string, sig []byte) bool {
+	sum := sha256.Sum256([]byte(signed))
+
+	switch k := key.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, sum[:], r, s)
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), sig)
+	}
+	return false
+}
+
+func (c jwtClaims) hasAudience(audience string) bool {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return one == audience
+	}
+	var many []string
+	if json.Unmarshal(c.Audience, &many) == nil {
+		for _, a := range many {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c jwtClaims) role() string {
+	role := c.Role
+	for _, r := range c.Roles {
+		if roleLevels[r] > roleLevels[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// Authenticate - "Authorization: Bearer <JWT>"
+func (a jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerScheme) {
+		return nil, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(auth, bearerScheme), ".")
+	if len(parts) != 3 {
+		return nil, errUnauthorized
+	}
+
+	data, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, errUnauthorized
+	}
+
+	// The key decides the algorithm, so tokens can not downgrade it
+	key, ok := a.keys[header.Kid]
+	if !ok || key.alg != header.Alg {
+		return nil, errUnauthorized
+	}
+
+	sig, err := decodeSegment(parts[2])
+	if err != nil || !verifySignature(key, parts[0]+"."+parts[1], sig) {
+		return nil, errUnauthorized
+	}
+
+	data, err = decodeSegment(parts[1])
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	claims := jwtClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errUnauthorized
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return nil, errUnauthorized
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-jwtLeeway)) {
+		return nil, errUnauthorized
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, errUnauthorized
+	}
+	if a.audience != "" && !claims.hasAudience(a.audience) {
+		return nil, errUnauthorized
+	}
+
+	role := claims.role()
+	if _, ok := roleLevels[role]; !ok || claims.Subject == "" {
+		return nil, errUnauthorized
+	}
+	return &Principal{Name: claims.Subject, Role: role}, nil
+}
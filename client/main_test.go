@@ -0,0 +1,31 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/drasko/edgex-export/memory"
+	"go.uber.org/zap"
+)
+
+var ts *httptest.Server
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop()
+	r := memory.NewRepository()
+	InitRepository(r)
+	InitHistory(r)
+	ts = httptest.NewServer(httpServer())
+
+	code := m.Run()
+
+	ts.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,89 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drasko/edgex-export"
+)
+
+const mimeTypeMergePatch = "application/merge-patch+json"
+
+// mergePatch - apply an RFC 7396 JSON merge patch to target. Objects are
+// merged recursively, null removes a member and any other value replaces it
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// mergeRegistration - apply the merge patch in data to reg
+func mergeRegistration(reg export.Registration, data []byte) (export.Registration, error) {
+	var patch interface{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return reg, err
+	}
+
+	doc, err := json.Marshal(reg)
+	if err != nil {
+		return reg, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return reg, err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return reg, err
+	}
+
+	res := export.Registration{}
+	err = json.Unmarshal(merged, &res)
+	return res, err
+}
+
+// etag - entity tag of a stored registration. Modified is bumped on every
+// update, so it identifies the registration version
+func etag(reg export.Registration) string {
+	return `"` + strconv.FormatInt(reg.Modified, 10) + `"`
+}
+
+// ifMatch - check the If-Match precondition of r against reg
+func ifMatch(r *http.Request, reg export.Registration) bool {
+	match := r.Header.Get("If-Match")
+	return match == "" || match == "*" || match == etag(reg)
+}
+
+// nextModified - modification time, in milliseconds, for a registration last
+// modified at prev. It always increases so ETags are never reused
+func nextModified(prev int64) int64 {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now <= prev {
+		now = prev + 1
+	}
+	return now
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396 appendix A
+	cases := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for i, c := range cases {
+		var target, patch, result interface{}
+		json.Unmarshal([]byte(c.target), &target)
+		json.Unmarshal([]byte(c.patch), &patch)
+		json.Unmarshal([]byte(c.result), &result)
+
+		if res := mergePatch(target, patch); !reflect.DeepEqual(res, result) {
+			t.Errorf("case %d: expected %v got %v", i+1, result, res)
+		}
+	}
+}
+
+func patchRequest(url, body, match string) (*http.Response, error) {
+	req, err := http.NewRequest("PATCH", ts.URL+url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mimeTypeMergePatch)
+	if match != "" {
+		req.Header.Set("If-Match", match)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestPatchRegistration(t *testing.T) {
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	url := "/api/v1/registration/" + string(body)
+	defer doRequest("DELETE", url, "")
+
+	res, err = doRequest("GET", url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	tag := res.Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("Missing ETag")
+	}
+
+	cases := []struct {
+		body  string
+		match string
+		code  int
+	}{
+		{`{"format":"INVALID"}`, "", http.StatusUnprocessableEntity},
+		{`{"addressable":{"Topic":null}}`, "", http.StatusUnprocessableEntity},
+		{`{"format":`, "", http.StatusBadRequest},
+		{`{"format":"XML","addressable":{"Port":1884}}`, tag, http.StatusOK},
+		// The previous patch changed the ETag
+		{`{"format":"JSON"}`, tag, http.StatusPreconditionFailed},
+		{`{"format":"JSON"}`, "*", http.StatusOK},
+	}
+
+	for i, c := range cases {
+		res, err := patchRequest(url, c.body, c.match)
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+
+	res, err = doRequest("GET", url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := export.Registration{}
+	err = json.NewDecoder(res.Body).Decode(&reg)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg.Format != export.FormatJSON || reg.Addressable.Port != 1884 ||
+		reg.Addressable.Address != "127.0.0.1" || reg.Destination != export.DestMQTT {
+		t.Fatal("Unexpected patched registration", reg)
+	}
+	if reg.Modified <= reg.Created {
+		t.Fatal("Modified should be bumped", reg.Created, reg.Modified)
+	}
+}
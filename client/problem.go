@@ -0,0 +1,47 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/drasko/edgex-export"
+)
+
+const mimeTypeProblem = "application/problem+json"
+
+// problem - RFC 7807 problem details, with the field errors of invalid
+// registrations
+type problem struct {
+	Type   string                 `json:"type"`
+	Title  string                 `json:"title"`
+	Status int                    `json:"status"`
+	Detail string                 `json:"detail,omitempty"`
+	Errors export.ValidationError `json:"errors,omitempty"`
+}
+
+// writeProblem - reply with a problem document. Validation errors are
+// replied with their field errors and 422 status
+func writeProblem(w http.ResponseWriter, status int, err error) {
+	p := problem{
+		Type:   "about:blank",
+		Status: status,
+		Detail: err.Error(),
+	}
+	if errs, ok := err.(export.ValidationError); ok {
+		p.Status = http.StatusUnprocessableEntity
+		p.Errors = errs
+	}
+	p.Title = http.StatusText(p.Status)
+
+	res, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", mimeTypeProblem)
+	w.WriteHeader(p.Status)
+	io.WriteString(w, string(res))
+}
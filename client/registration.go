@@ -11,39 +11,76 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/drasko/edgex-export"
-	"github.com/drasko/edgex-export/mongo"
 	"github.com/go-zoo/bone"
 	"go.uber.org/zap"
 	"gopkg.in/mgo.v2/bson"
 )
 
-const (
-	distroPort int = 48070
-)
+// repoErrorStatus - HTTP status for a repository error
+func repoErrorStatus(err error) int {
+	switch err {
+	case export.ErrNotFound, export.ErrVersionNotFound:
+		return http.StatusNotFound
+	case export.ErrDuplicateName:
+		return http.StatusBadRequest
+	case export.ErrConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// validID - check that the id path parameter is an ObjectId, replying with
+// bad request otherwise
+func validID(w http.ResponseWriter, id string) bool {
+	if !bson.IsObjectIdHex(id) {
+		logger.Error("Invalid id", zap.String("id", id))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Invalid id: "+id)
+		return false
+	}
+	return true
+}
+
+// readOnly - check that reg is not managed by a file, replying with conflict
+// otherwise
+func readOnly(w http.ResponseWriter, reg export.Registration) bool {
+	if reg.FileManaged() {
+		logger.Error("Registration is read only", zap.String("name", reg.Name),
+			zap.String("managedBy", reg.ManagedBy))
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, "Registration "+reg.Name+" is managed by "+reg.ManagedBy)
+		return true
+	}
+	return false
+}
 
 func getRegByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return
+	}
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
-
-	reg := export.Registration{}
-	if err := c.Find(bson.M{"id": id}).One(&reg); err != nil {
+	reg, err := repo.RegistrationByID(id)
+	if err != nil {
 		logger.Error("Failed to query by id", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
 
+	redactSecrets(&reg)
 	res, err := json.Marshal(reg)
 	if err != nil {
 		logger.Error("Failed to query by id", zap.Error(err))
@@ -52,31 +89,31 @@ func getRegByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", etag(reg))
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(res))
 }
 
+// getRegList - names of the capabilities of distro of a type
 func getRegList(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	t := bone.GetValue(r, "type")
 
+	caps := currentCapabilities()
 	var list []string
 
 	switch t {
 	case "algorithms":
-		list = append(list, export.EncNone)
-		list = append(list, export.EncAes)
+		list = export.Names(caps.Algorithms)
 	case "compressions":
-		list = append(list, export.CompNone)
-		list = append(list, export.CompGzip)
-		list = append(list, export.CompZip)
+		list = export.Names(caps.Compressions)
 	case "formats":
-		list = append(list, export.FormatJSON)
-		list = append(list, export.FormatXML)
+		list = export.Names(caps.Formats)
 	case "destinations":
-		list = append(list, export.DestMQTT)
-		list = append(list, export.DestRest)
+		list = export.Names(caps.Destinations)
+	case "filters":
+		list = export.Names(caps.Filters)
 	default:
 		logger.Error("Unknown type: " + t)
 		w.WriteHeader(http.StatusBadRequest)
@@ -96,21 +133,80 @@ func getRegList(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, string(res))
 }
 
+// parseRegistrationQuery - read the listing filters, sort and page from the
+// url query
+func parseRegistrationQuery(values url.Values) (export.RegistrationQuery, error) {
+	q := export.RegistrationQuery{
+		Destination: values.Get("destination"),
+		Format:      values.Get("format"),
+		Label:       values.Get("label"),
+		Sort:        values.Get("sort"),
+	}
+
+	if !q.ValidSort() {
+		return q, errors.New("Invalid sort: " + q.Sort)
+	}
+
+	if v := values.Get("enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, errors.New("Invalid enabled: " + v)
+		}
+		q.Enabled = &enabled
+	}
+
+	var err error
+	if v := values.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, errors.New("Invalid offset: " + v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			return q, errors.New("Invalid limit: " + v)
+		}
+	}
+	return q, nil
+}
+
+// getAllReg - list registrations. The result can be filtered by destination,
+// format, enabled and label, sorted by name, created or modified (descending
+// with a "-" prefix) and paged with offset and limit. X-Total-Count has the
+// number of registrations passing the filters
 func getAllReg(w http.ResponseWriter, r *http.Request) {
+	listRegistrations(w, r, true)
+}
+
+// getAllRegInternal - getAllReg with the secrets, for distro
+func getAllRegInternal(w http.ResponseWriter, r *http.Request) {
+	listRegistrations(w, r, false)
+}
+
+func listRegistrations(w http.ResponseWriter, r *http.Request, redact bool) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
+	q, err := parseRegistrationQuery(r.URL.Query())
+	if err != nil {
+		logger.Error("Failed to parse query", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
 
-	reg := []export.Registration{}
-	if err := c.Find(nil).All(&reg); err != nil {
+	reg, total, err := repo.Registrations(q)
+	if err != nil {
 		logger.Error("Failed to query all registrations", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, err.Error())
 		return
 	}
 
+	if redact {
+		for i := range reg {
+			redactSecrets(&reg[i])
+		}
+	}
+
 	res, err := json.Marshal(reg)
 	if err != nil {
 		logger.Error("Failed to query all registrations", zap.Error(err))
@@ -119,27 +215,36 @@ func getAllReg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(res))
 }
 
 func getRegByName(w http.ResponseWriter, r *http.Request) {
+	findRegByName(w, r, true)
+}
+
+// getRegByNameInternal - getRegByName with the secrets, for distro
+func getRegByNameInternal(w http.ResponseWriter, r *http.Request) {
+	findRegByName(w, r, false)
+}
+
+func findRegByName(w http.ResponseWriter, r *http.Request, redact bool) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	name := bone.GetValue(r, "name")
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
-
-	reg := export.Registration{}
-	if err := c.Find(bson.M{"name": name}).One(&reg); err != nil {
+	reg, err := repo.RegistrationByName(name)
+	if err != nil {
 		logger.Error("Failed to query by name", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
 
+	if redact {
+		redactSecrets(&reg)
+	}
 	res, err := json.Marshal(reg)
 	if err != nil {
 		logger.Error("Failed to query by name", zap.Error(err))
@@ -148,10 +253,40 @@ func getRegByName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", etag(reg))
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(res))
 }
 
+// getRegSchema - XSD of the documents sent by an XML registration
+func getRegSchema(w http.ResponseWriter, r *http.Request) {
+	name := bone.GetValue(r, "name")
+
+	reg, err := repo.RegistrationByName(name)
+	if err != nil {
+		logger.Error("Failed to query by name", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+	if reg.Format != export.FormatXML {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "No schema for format "+reg.Format)
+		return
+	}
+
+	xsd, err := export.XMLSchema(reg.XMLOptions())
+	if err != nil {
+		logger.Error("Failed to generate schema", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(xsd)
+}
+
 func addReg(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -164,47 +299,99 @@ func addReg(w http.ResponseWriter, r *http.Request) {
 	reg := export.Registration{}
 	if err := json.Unmarshal(data, &reg); err != nil {
 		logger.Error("Failed to query add registration", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, err.Error())
+		writeProblem(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if !reg.Validate() {
-		logger.Error("Failed to validate registrations fields", zap.ByteString("data", data))
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "Could not validate json fields")
+	// IDs are always generated by the repository
+	reg.ID = ""
+	reg.Created = 0
+	createRegistration(w, r, reg)
+}
+
+// createRegistration - validate and store a new registration. The ID and
+// Created of restored registrations are kept
+func createRegistration(w http.ResponseWriter, r *http.Request, reg export.Registration) {
+	// Only the registration files can set registrations as file managed
+	reg.ManagedBy = ""
+
+	if err := maskedSecrets(reg); err != nil {
+		logger.Error("Failed to validate registrations fields", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
 		return
 	}
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
+	if err := reg.ValidateWith(currentCapabilities()); err != nil {
+		logger.Error("Failed to validate registrations fields", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
 
-	count, err := c.Find(bson.M{"name": reg.Name}).Count()
+	reg.Modified = nextModified(0)
+	if reg.Created == 0 {
+		reg.Created = reg.Modified
+	}
+	id, err := repo.AddRegistration(reg)
 	if err != nil {
 		logger.Error("Failed to query add registration", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
-	if count != 0 {
-		logger.Error("Username already taken: " + reg.Name)
+	reg.ID = bson.ObjectIdHex(id)
+
+	w.Header().Set("Location", "/api/v1/registration/"+id)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, id)
+	registrationChanged(r, export.NotifyUpdate{Name: reg.Name, Operation: export.NotifyUpdateAdd}, nil, &reg)
+}
+
+func updateReg(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed to query update registration", zap.Error(err))
 		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
 		return
 	}
 
-	if err := c.Insert(reg); err != nil {
-		logger.Error("Failed to query add registration", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		logger.Error("Failed to query update registration", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, err.Error())
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	notifyUpdatedRegistrations(export.NotifyUpdate{reg.Name, "add"})
+	reg, err := repo.RegistrationByName(body.Name)
+	if err != nil {
+		logger.Error("Failed to query update registration", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	// Fields missing in the body keep their stored value
+	updated := reg
+	if err := json.Unmarshal(data, &updated); err != nil {
+		logger.Error("Failed to query update registration", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	applyUpdate(w, r, reg, updated)
 }
 
-func updateReg(w http.ResponseWriter, r *http.Request) {
+// updateRegByID - update the registration with the id in the path. Unlike
+// updateReg the name can be changed, renaming the registration
+func updateRegByID(w http.ResponseWriter, r *http.Request) {
+	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return
+	}
+
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("Failed to query update registration", zap.Error(err))
@@ -213,83 +400,195 @@ func updateReg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body map[string]interface{}
-	if err := json.Unmarshal(data, &body); err != nil {
+	reg, err := repo.RegistrationByID(id)
+	if err != nil {
 		logger.Error("Failed to query update registration", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
+		return
+	}
+
+	// Fields missing in the body keep their stored value
+	updated := reg
+	if err := json.Unmarshal(data, &updated); err != nil {
+		logger.Error("Failed to query update registration", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
 	}
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
+	applyUpdate(w, r, reg, updated)
+}
+
+// patchRegByID - update the registration with the id in the path applying
+// the RFC 7396 merge patch in the body
+func patchRegByID(w http.ResponseWriter, r *http.Request) {
+	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return
+	}
 
-	name := body["name"]
-	query := bson.M{"name": name}
-	update := bson.M{"$set": body}
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, mimeTypeMergePatch) &&
+		!strings.HasPrefix(contentType, "application/json") {
+		logger.Error("Unsupported patch type", zap.String("type", contentType))
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		io.WriteString(w, "Unsupported patch type: "+contentType)
+		return
+	}
 
-	if err := c.Update(query, update); err != nil {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed to query patch registration", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	reg, err := repo.RegistrationByID(id)
+	if err != nil {
+		logger.Error("Failed to query patch registration", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	updated, err := mergeRegistration(reg, data)
+	if err != nil {
+		logger.Error("Failed to query patch registration", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	applyUpdate(w, r, reg, updated)
+}
+
+// applyUpdate - validate and store the update of reg. The update is only
+// stored if reg was not modified in between and, if the request has an
+// If-Match header, if it matches the ETag of reg
+func applyUpdate(w http.ResponseWriter, r *http.Request, reg, updated export.Registration) {
+	if readOnly(w, reg) {
+		return
+	}
+
+	if !ifMatch(r, reg) {
+		logger.Error("Registration was modified", zap.String("name", reg.Name))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, export.ErrConflict.Error())
+		return
+	}
+
+	updated.ID = reg.ID
+	updated.Created = reg.Created
+	updated.Modified = nextModified(reg.Modified)
+	updated.ManagedBy = reg.ManagedBy
+	keepSecrets(reg, &updated)
+
+	if err := updated.ValidateWith(currentCapabilities()); err != nil {
+		logger.Error("Failed to validate registrations fields", zap.Error(err))
+		writeProblem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := repo.UpdateRegistration(updated, reg.Modified); err != nil {
 		logger.Error("Failed to query update registration", zap.Error(err))
-		w.WriteHeader(http.StatusNotFound)
+		status := repoErrorStatus(err)
+		if err == export.ErrConflict && r.Header.Get("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
+		w.WriteHeader(status)
 		io.WriteString(w, err.Error())
 		return
 	}
 
+	w.Header().Set("ETag", etag(updated))
 	w.WriteHeader(http.StatusOK)
-	notifyUpdatedRegistrations(export.NotifyUpdate{name.(string), "update"})
+	if updated.Name != reg.Name {
+		registrationChanged(r, export.NotifyUpdate{
+			Name:      reg.Name,
+			NewName:   updated.Name,
+			Operation: export.NotifyUpdateRename,
+		}, &reg, &updated)
+	} else {
+		registrationChanged(r, export.NotifyUpdate{Name: updated.Name, Operation: export.NotifyUpdateUpdate},
+			&reg, &updated)
+	}
 }
 
 func delRegByID(w http.ResponseWriter, r *http.Request) {
 	id := bone.GetValue(r, "id")
+	if !validID(w, id) {
+		return
+	}
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
-
-	// Read the registration from mongo, the registration name is needed to
+	// Read the registration first, the registration name is needed to
 	// notify distro of the deletion
-	reg := export.Registration{}
-	if err := c.Find(bson.M{"id": id}).One(&reg); err != nil {
+	reg, err := repo.RegistrationByID(id)
+	if err != nil {
 		logger.Error("Failed to query by id", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
 
-	if err := c.Remove(bson.M{"id": id}); err != nil {
+	if readOnly(w, reg) {
+		return
+	}
+
+	if err := repo.DeleteRegistrationByID(id); err != nil {
 		logger.Error("Failed to query by id", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	notifyUpdatedRegistrations(export.NotifyUpdate{reg.Name, "delete"})
+	registrationChanged(r, export.NotifyUpdate{Name: reg.Name, Operation: export.NotifyUpdateDelete}, &reg, nil)
 }
 
 func delRegByName(w http.ResponseWriter, r *http.Request) {
 	name := bone.GetValue(r, "name")
 
-	s := repo.Session.Copy()
-	defer s.Close()
-	c := s.DB(mongo.DBName).C(mongo.CollectionName)
+	// Read the registration first, its ID is needed to record the deletion
+	reg, err := repo.RegistrationByName(name)
+	if err != nil {
+		logger.Error("Failed to query by name", zap.Error(err))
+		w.WriteHeader(repoErrorStatus(err))
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	if readOnly(w, reg) {
+		return
+	}
 
-	if err := c.Remove(bson.M{"name": name}); err != nil {
+	if err := repo.DeleteRegistrationByName(name); err != nil {
 		logger.Error("Failed to query by name", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(repoErrorStatus(err))
 		io.WriteString(w, err.Error())
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	notifyUpdatedRegistrations(export.NotifyUpdate{name, "delete"})
+	registrationChanged(r, export.NotifyUpdate{Name: name, Operation: export.NotifyUpdateDelete}, &reg, nil)
+}
+
+// distroURL - URL of a distro endpoint
+func distroURL(path string) string {
+	return "http://" + cfg.DistroHost + ":" + strconv.Itoa(cfg.DistroPort) + path
 }
 
 func notifyUpdatedRegistrations(update export.NotifyUpdate) {
+	feed.publish(update)
+
+	// Distro watches the change feed, pushing is only kept for distro
+	// instances that do not watch
+	if !cfg.NotifyDistro {
+		return
+	}
+
 	go func() {
 		client := &http.Client{}
-		url := "http://" + cfg.DistroHost + ":" + strconv.Itoa(distroPort) +
-			"/api/v1/notify/registrations"
+		url := distroURL("/api/v1/notify/registrations")
 
 		data, err := json.Marshal(update)
 		if err != nil {
@@ -0,0 +1,264 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	validReg   = `{"name":"reg1","format":"JSON","destination":"MQTT_TOPIC","addressable":{"Address":"127.0.0.1","Port":1883,"Topic":"topic"}}`
+	invalidReg = `{"name":"reg2","format":"JSON","destination":"INVALID"}`
+)
+
+func doRequest(method, url, body string) (*http.Response, error) {
+	req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestRegistrationHandlers(t *testing.T) {
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"POST", "/api/v1/registration", validReg, http.StatusCreated},
+		{"POST", "/api/v1/registration", validReg, http.StatusBadRequest},
+		{"POST", "/api/v1/registration", invalidReg, http.StatusUnprocessableEntity},
+		{"POST", "/api/v1/registration", "{", http.StatusBadRequest},
+		{"GET", "/api/v1/registration/name/reg1", "", http.StatusOK},
+		{"GET", "/api/v1/registration/name/unknown", "", http.StatusNotFound},
+		{"PUT", "/api/v1/registration", `{"name":"reg1","format":"XML"}`, http.StatusOK},
+		{"PUT", "/api/v1/registration", `{"name":"unknown"}`, http.StatusNotFound},
+		{"GET", "/api/v1/registration", "", http.StatusOK},
+		{"DELETE", "/api/v1/registration/name/reg1", "", http.StatusOK},
+		{"DELETE", "/api/v1/registration/name/reg1", "", http.StatusNotFound},
+	}
+
+	for i, c := range cases {
+		res, err := doRequest(c.method, c.url, c.body)
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+}
+
+func TestUpdateKeepsFields(t *testing.T) {
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	defer doRequest("DELETE", "/api/v1/registration/name/reg1", "")
+
+	res, err = doRequest("PUT", "/api/v1/registration", `{"name":"reg1","format":"XML"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = doRequest("GET", "/api/v1/registration/name/reg1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := export.Registration{}
+	err = json.NewDecoder(res.Body).Decode(&reg)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg.Format != export.FormatXML || reg.Destination != export.DestMQTT ||
+		reg.Addressable.Topic != "topic" {
+		t.Fatal("Update should only change the fields in the body", reg)
+	}
+}
+
+func TestRegistrationByID(t *testing.T) {
+	res, err := doRequest("POST", "/api/v1/registration", validReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := string(body)
+	if !bson.IsObjectIdHex(id) {
+		t.Fatal("Expected an id got", id)
+	}
+	if res.Header.Get("Location") != "/api/v1/registration/"+id {
+		t.Fatal("Unexpected location", res.Header.Get("Location"))
+	}
+
+	unknown := bson.NewObjectId().Hex()
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"GET", "/api/v1/registration/" + id, "", http.StatusOK},
+		{"GET", "/api/v1/registration/invalid", "", http.StatusBadRequest},
+		{"GET", "/api/v1/registration/" + unknown, "", http.StatusNotFound},
+		{"PUT", "/api/v1/registration/" + unknown, `{"format":"XML"}`, http.StatusNotFound},
+		{"PUT", "/api/v1/registration/" + id, `{"name":""}`, http.StatusUnprocessableEntity},
+		{"PUT", "/api/v1/registration/" + id, `{"name":"renamed"}`, http.StatusOK},
+		{"GET", "/api/v1/registration/name/renamed", "", http.StatusOK},
+		{"GET", "/api/v1/registration/name/reg1", "", http.StatusNotFound},
+		{"DELETE", "/api/v1/registration/invalid", "", http.StatusBadRequest},
+		{"DELETE", "/api/v1/registration/" + id, "", http.StatusOK},
+		{"DELETE", "/api/v1/registration/id/" + id, "", http.StatusNotFound},
+	}
+
+	for i, c := range cases {
+		res, err := doRequest(c.method, c.url, c.body)
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+		}
+	}
+}
+
+func TestGetAllRegQuery(t *testing.T) {
+	for _, name := range []string{"q2", "q1", "q3"} {
+		body := `{"name":"` + name + `","format":"JSON","destination":"REST_ENDPOINT","labels":["` + name + `"],` +
+			`"addressable":{"Address":"127.0.0.1","Port":8080,"Method":"POST"}}`
+		res, err := doRequest("POST", "/api/v1/registration", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		defer doRequest("DELETE", "/api/v1/registration/name/"+name, "")
+	}
+
+	cases := []struct {
+		query string
+		code  int
+		names string
+		total string
+	}{
+		{"?destination=REST_ENDPOINT&sort=name", http.StatusOK, "q1q2q3", "3"},
+		{"?destination=REST_ENDPOINT&sort=-name&limit=2", http.StatusOK, "q3q2", "3"},
+		{"?destination=REST_ENDPOINT&sort=name&offset=2", http.StatusOK, "q3", "3"},
+		{"?label=q2", http.StatusOK, "q2", "1"},
+		{"?enabled=true", http.StatusOK, "", "0"},
+		{"?sort=unknown", http.StatusBadRequest, "", ""},
+		{"?limit=-1", http.StatusBadRequest, "", ""},
+		{"?enabled=maybe", http.StatusBadRequest, "", ""},
+	}
+
+	for i, c := range cases {
+		res, err := doRequest("GET", "/api/v1/registration"+c.query, "")
+		if err != nil {
+			t.Fatalf("case %d: %s", i+1, err.Error())
+		}
+		regs := []export.Registration{}
+		if res.StatusCode == http.StatusOK {
+			json.NewDecoder(res.Body).Decode(&regs)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, res.StatusCode)
+			continue
+		}
+		names := ""
+		for _, reg := range regs {
+			names += reg.Name
+		}
+		if names != c.names || res.Header.Get("X-Total-Count") != c.total {
+			t.Errorf("case %d: expected %s (%s) got %s (%s)", i+1, c.names, c.total,
+				names, res.Header.Get("X-Total-Count"))
+		}
+	}
+}
+
+func TestAddRegValidationErrors(t *testing.T) {
+	body := `{"name":"invalid","format":"JSON","destination":"REST_ENDPOINT","addressable":{"Port":70000}}`
+	res, err := doRequest("POST", "/api/v1/registration", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := problem{}
+	err = json.NewDecoder(res.Body).Decode(&p)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusUnprocessableEntity || p.Status != res.StatusCode {
+		t.Fatal("Unexpected status", res.StatusCode, p.Status)
+	}
+	if res.Header.Get("Content-Type") != mimeTypeProblem {
+		t.Fatal("Unexpected content type", res.Header.Get("Content-Type"))
+	}
+
+	expected := map[string]string{
+		"addressable.Address": export.CodeRequired,
+		"addressable.Port":    export.CodeOutOfRange,
+		"addressable.Method":  export.CodeRequired,
+	}
+	if len(p.Errors) != len(expected) {
+		t.Fatal("Unexpected errors", p.Errors)
+	}
+	for _, e := range p.Errors {
+		if expected[e.Field] != e.Code {
+			t.Error("Unexpected error", e)
+		}
+	}
+}
+
+func TestGetRegSchema(t *testing.T) {
+	reg := `{"name":"xml","format":"XML","destination":"MQTT_TOPIC",` +
+		`"addressable":{"Address":"127.0.0.1","Port":1883,"Topic":"topic"},` +
+		`"xml":{"root":"Data","namespace":"urn:export","readings":"attributes"}}`
+	if res, err := doRequest("POST", "/api/v1/registration", reg); err != nil || res.StatusCode != http.StatusCreated {
+		t.Fatal("Failed to add registration", err)
+	}
+	defer doRequest("DELETE", "/api/v1/registration/name/xml", "")
+
+	res, err := doRequest("GET", "/api/v1/registration/xml/schema", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `targetNamespace="urn:export"`) ||
+		!strings.Contains(string(body), `<xs:element name="Data">`) {
+		t.Fatal("Unexpected schema", res.StatusCode, string(body))
+	}
+
+	if res, _ = doRequest("GET", "/api/v1/registration/unknown/schema", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatal("Unknown registration should not be found", res.StatusCode)
+	}
+	doRequest("PUT", "/api/v1/registration", `{"name":"xml","format":"JSON"}`)
+	if res, _ = doRequest("GET", "/api/v1/registration/xml/schema", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatal("JSON registrations should have no schema", res.StatusCode)
+	}
+}
@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import "github.com/drasko/edgex-export"
+
+// RegistrationRepository - storage of the export registrations. Lookups
+// return export.ErrNotFound for unknown registrations and adding a
+// registration returns export.ErrDuplicateName if the name is taken
+type RegistrationRepository interface {
+	// Registrations - registrations matching the query and the number of
+	// registrations passing its filters, ignoring its offset and limit
+	Registrations(q export.RegistrationQuery) ([]export.Registration, int, error)
+	RegistrationByID(id string) (export.Registration, error)
+	RegistrationByName(name string) (export.Registration, error)
+	// AddRegistration - stores a new registration and returns its ID
+	AddRegistration(reg export.Registration) (string, error)
+	// UpdateRegistration - replaces the registration with the same ID if
+	// its stored Modified value is still modified, export.ErrConflict is
+	// returned otherwise. It returns export.ErrDuplicateName if renamed to
+	// a taken name
+	UpdateRegistration(reg export.Registration, modified int64) error
+	DeleteRegistrationByID(id string) error
+	DeleteRegistrationByName(name string) error
+}
+
+// HistoryRepository - storage of the registration versions, which are kept
+// after the registration is deleted
+type HistoryRepository interface {
+	// AddVersion - store v as the next version of its registration and
+	// return the version number, starting from 1
+	AddVersion(v export.RegistrationVersion) (int, error)
+	// Versions - versions of the registration with id, oldest first
+	Versions(id string) ([]export.RegistrationVersion, error)
+	// Version - returns export.ErrVersionNotFound for unknown versions
+	Version(id string, version int) (export.RegistrationVersion, error)
+}
+
+var repo RegistrationRepository
+
+var history HistoryRepository
+
+// InitRepository - Init registration repository
+func InitRepository(r RegistrationRepository) {
+	repo = r
+	return
+}
+
+// InitHistory - Init registration history repository
+func InitHistory(h HistoryRepository) {
+	history = h
+}
@@ -0,0 +1,379 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/drasko/edgex-export"
+)
+
+// SecretMask - value returned instead of the secrets of a registration.
+// Sending it back in an update keeps the stored secret
+const SecretMask = "******"
+
+// Prefix of encrypted secrets, "enc:<key id>:<base64 nonce and ciphertext>"
+const secretPrefix = "enc:"
+
+// Key ID of a master key set without a keyring file
+const defaultKeyID = "default"
+
+var (
+	errInvalidMasterKey = errors.New("master key must be 32 base64 encoded bytes")
+	errUnknownKeyID     = errors.New("secret encrypted with an unknown master key")
+	errInvalidSecret    = errors.New("invalid encrypted secret")
+)
+
+// Keyring - master keys encrypting the registration secrets at rest. New
+// secrets are encrypted with the primary key, the other keys are kept to
+// decrypt secrets stored before rotating the primary key
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+func newAEAD(encoded string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errInvalidMasterKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewKeyring - keyring with a single base64 encoded AES-256 master key
+func NewKeyring(key string) (*Keyring, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{
+		primary: defaultKeyID,
+		keys:    map[string]cipher.AEAD{defaultKeyID: aead},
+	}, nil
+}
+
+// LoadKeyring - read a keyring file, a JSON object with the base64 encoded
+// master keys by ID and the ID of the primary one:
+// {"primary": "2", "keys": {"1": "...", "2": "..."}}
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		Primary string            `json:"primary"`
+		Keys    map[string]string `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{primary: file.Primary, keys: make(map[string]cipher.AEAD)}
+	for id, key := range file.Keys {
+		if strings.Contains(id, ":") {
+			return nil, errors.New("invalid master key id: " + id)
+		}
+		if k.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := k.keys[k.primary]; !ok {
+		return nil, errors.New("unknown primary master key: " + k.primary)
+	}
+	return k, nil
+}
+
+// encrypt - encrypt a secret with the primary key. The field name is
+// authenticated, so ciphertexts can not be moved to other fields
+func (k *Keyring) encrypt(field, secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(field))
+	return secretPrefix + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt - decrypt a stored secret. Secrets stored before encryption was
+// enabled are returned as they are
+func (k *Keyring) decrypt(field, stored string) (string, error) {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return stored, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(stored, secretPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errInvalidSecret
+	}
+	aead, ok := k.keys[parts[0]]
+	if !ok {
+		return "", errUnknownKeyID
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errInvalidSecret
+	}
+	n := aead.NonceSize()
+	secret, err := aead.Open(nil, sealed[:n], sealed[n:], []byte(field))
+	if err != nil {
+		return "", errInvalidSecret
+	}
+	return string(secret), nil
+}
+
+// current - check if a stored secret is encrypted with the primary key
+func (k *Keyring) current(stored string) bool {
+	return stored == "" || strings.HasPrefix(stored, secretPrefix+k.primary+":")
+}
+
+// secretFields - secrets of a registration and their field names
+func secretFields(reg *export.Registration) map[string]*string {
+	return map[string]*string{
+		"addressable.Password":          &reg.Addressable.Password,
+		"encryption.encryptionKey":      &reg.Encryption.Key,
+		"encryption.initializingVector": &reg.Encryption.InitVector,
+	}
+}
+
+// redactSecrets - replace the secrets that are set with SecretMask
+func redactSecrets(reg *export.Registration) {
+	for _, s := range secretFields(reg) {
+		if *s != "" {
+			*s = SecretMask
+		}
+	}
+}
+
+// keepSecrets - restore the secrets of reg left masked in updated
+func keepSecrets(reg export.Registration, updated *export.Registration) {
+	stored := secretFields(&reg)
+	for field, s := range secretFields(updated) {
+		if *s == SecretMask {
+			*s = *stored[field]
+		}
+	}
+}
+
+// maskChanges - mask the secret values of changes
+func maskChanges(changes []export.FieldChange) []export.FieldChange {
+	secrets := secretFields(&export.Registration{})
+	for i := range changes {
+		if _, ok := secrets[changes[i].Field]; !ok {
+			continue
+		}
+		if changes[i].Old != nil {
+			changes[i].Old = SecretMask
+		}
+		if changes[i].New != nil {
+			changes[i].New = SecretMask
+		}
+	}
+	return changes
+}
+
+// maskedSecrets - validation error for new registrations with masked
+// secrets, which have no stored value to keep
+func maskedSecrets(reg export.Registration) error {
+	var errs export.ValidationError
+	for field, s := range secretFields(&reg) {
+		if *s == SecretMask {
+			errs = append(errs, export.FieldError{
+				Field:   field,
+				Code:    export.CodeInvalid,
+				Message: "masked secret can only be sent to keep a stored secret",
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// secretRepository - repository decorator encrypting the registration
+// secrets before storing them and decrypting them when read
+type secretRepository struct {
+	RegistrationRepository
+	keyring *Keyring
+}
+
+// NewSecretRepository - encrypt the secrets stored in repo with keyring
+func NewSecretRepository(repo RegistrationRepository, keyring *Keyring) RegistrationRepository {
+	return secretRepository{RegistrationRepository: repo, keyring: keyring}
+}
+
+func (r secretRepository) encrypt(reg *export.Registration) error {
+	for field, s := range secretFields(reg) {
+		enc, err := r.keyring.encrypt(field, *s)
+		if err != nil {
+			return err
+		}
+		*s = enc
+	}
+	return nil
+}
+
+func (r secretRepository) decrypt(reg *export.Registration) error {
+	for field, s := range secretFields(reg) {
+		dec, err := r.keyring.decrypt(field, *s)
+		if err != nil {
+			return err
+		}
+		*s = dec
+	}
+	return nil
+}
+
+func (r secretRepository) Registrations(q export.RegistrationQuery) ([]export.Registration, int, error) {
+	regs, total, err := r.RegistrationRepository.Registrations(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range regs {
+		if err := r.decrypt(&regs[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return regs, total, nil
+}
+
+func (r secretRepository) RegistrationByID(id string) (export.Registration, error) {
+	reg, err := r.RegistrationRepository.RegistrationByID(id)
+	if err != nil {
+		return reg, err
+	}
+	return reg, r.decrypt(&reg)
+}
+
+func (r secretRepository) RegistrationByName(name string) (export.Registration, error) {
+	reg, err := r.RegistrationRepository.RegistrationByName(name)
+	if err != nil {
+		return reg, err
+	}
+	return reg, r.decrypt(&reg)
+}
+
+func (r secretRepository) AddRegistration(reg export.Registration) (string, error) {
+	if err := r.encrypt(&reg); err != nil {
+		return "", err
+	}
+	return r.RegistrationRepository.AddRegistration(reg)
+}
+
+func (r secretRepository) UpdateRegistration(reg export.Registration, modified int64) error {
+	if err := r.encrypt(&reg); err != nil {
+		return err
+	}
+	return r.RegistrationRepository.UpdateRegistration(reg, modified)
+}
+
+// secretHistory - history decorator encrypting the secrets of the stored
+// versions as secretRepository does
+type secretHistory struct {
+	HistoryRepository
+	secrets secretRepository
+}
+
+// NewSecretHistory - encrypt the secrets of the versions stored in history
+// with keyring
+func NewSecretHistory(history HistoryRepository, keyring *Keyring) HistoryRepository {
+	return secretHistory{HistoryRepository: history, secrets: secretRepository{keyring: keyring}}
+}
+
+func (h secretHistory) AddVersion(v export.RegistrationVersion) (int, error) {
+	if v.Registration != nil {
+		reg := *v.Registration
+		if err := h.secrets.encrypt(&reg); err != nil {
+			return 0, err
+		}
+		v.Registration = &reg
+	}
+	return h.HistoryRepository.AddVersion(v)
+}
+
+func (h secretHistory) Versions(id string) ([]export.RegistrationVersion, error) {
+	versions, err := h.HistoryRepository.Versions(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Registration == nil {
+			continue
+		}
+		if err := h.secrets.decrypt(versions[i].Registration); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (h secretHistory) Version(id string, version int) (export.RegistrationVersion, error) {
+	v, err := h.HistoryRepository.Version(id, version)
+	if err != nil || v.Registration == nil {
+		return v, err
+	}
+	return v, h.secrets.decrypt(v.Registration)
+}
+
+// RotateSecrets - re-encrypt with the primary key the secrets stored with
+// older keys or in plaintext. It returns the number of updated
+// registrations
+func RotateSecrets(repo RegistrationRepository) (int, error) {
+	r, ok := repo.(secretRepository)
+	if !ok {
+		return 0, nil
+	}
+
+	regs, _, err := r.RegistrationRepository.Registrations(export.RegistrationQuery{})
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, reg := range regs {
+		current := true
+		for _, s := range secretFields(&reg) {
+			current = current && r.keyring.current(*s)
+		}
+		if current {
+			continue
+		}
+
+		if err := r.decrypt(&reg); err != nil {
+			return rotated, err
+		}
+		// Secrets are unchanged, so Modified and the ETag are kept
+		err := r.UpdateRegistration(reg, reg.Modified)
+		if err == export.ErrConflict {
+			// Updated in between, and so encrypted with the primary key
+			continue
+		}
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
@@ -0,0 +1,229 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"github.com/drasko/edgex-export/memory"
+)
+
+const secretReg = `{"name":"secret","format":"JSON","destination":"MQTT_TOPIC",` +
+	`"addressable":{"Address":"127.0.0.1","Port":1883,"Topic":"topic","Password":"pass"},` +
+	`"encryption":{"encryptionAlgorithm":"AES","encryptionKey":"key","initializingVector":"iv"}}`
+
+func masterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	res, err := doRequest("GET", url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	if _, err := NewKeyring("c2hvcnQ="); err != errInvalidMasterKey {
+		t.Fatal("Short master key should be rejected")
+	}
+
+	k, err := NewKeyring(masterKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := k.encrypt("addressable.Password", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, "enc:default:") || strings.Contains(enc, "pass") {
+		t.Fatal("Unexpected ciphertext", enc)
+	}
+	if dec, err := k.decrypt("addressable.Password", enc); err != nil || dec != "pass" {
+		t.Fatal("Secret should be decrypted", dec, err)
+	}
+	if _, err := k.decrypt("encryption.encryptionKey", enc); err != errInvalidSecret {
+		t.Fatal("Secret should be bound to its field")
+	}
+	if dec, err := k.decrypt("addressable.Password", "plain"); err != nil || dec != "plain" {
+		t.Fatal("Plaintext secrets should be returned unchanged")
+	}
+
+	other, _ := NewKeyring(masterKey('b'))
+	if _, err := other.decrypt("addressable.Password", enc); err != errInvalidSecret {
+		t.Fatal("Secret should not be decrypted with another key")
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved := repo
+	defer InitRepository(saved)
+
+	// Registrations stored before encryption was enabled
+	raw := memory.NewRepository()
+	InitRepository(raw)
+	res, err := doRequest("POST", "/api/v1/registration", secretReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	old, _ := NewKeyring(masterKey('a'))
+	InitRepository(NewSecretRepository(raw, old))
+	if n, err := RotateSecrets(repo); err != nil || n != 1 {
+		t.Fatal("Plaintext secrets should be encrypted", n, err)
+	}
+	stored, _ := raw.RegistrationByName("secret")
+	if !strings.HasPrefix(stored.Addressable.Password, "enc:default:") {
+		t.Fatal("Secret should be stored encrypted", stored.Addressable.Password)
+	}
+
+	// Rotation to a new primary key
+	path := filepath.Join(dir, "keyring.json")
+	ioutil.WriteFile(path, []byte(`{"primary":"new","keys":{"default":"`+
+		masterKey('a')+`","new":"`+masterKey('b')+`"}}`), 0600)
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitRepository(NewSecretRepository(raw, keyring))
+	if n, err := RotateSecrets(repo); err != nil || n != 1 {
+		t.Fatal("Secrets should be encrypted with the new key", n, err)
+	}
+	if n, _ := RotateSecrets(repo); n != 0 {
+		t.Fatal("Rotated secrets should be kept", n)
+	}
+	stored, _ = raw.RegistrationByName("secret")
+	if !strings.HasPrefix(stored.Encryption.Key, "enc:new:") {
+		t.Fatal("Secret should be encrypted with the primary key", stored.Encryption.Key)
+	}
+
+	// Secrets are masked in the public endpoints
+	reg := export.Registration{}
+	getJSON(t, "/api/v1/registration/name/secret", &reg)
+	if reg.Addressable.Password != SecretMask || reg.Encryption.Key != SecretMask ||
+		reg.Encryption.InitVector != SecretMask {
+		t.Fatal("Secrets should be masked", reg)
+	}
+	regs := []export.Registration{}
+	getJSON(t, "/api/v1/registration", &regs)
+	if len(regs) != 1 || regs[0].Addressable.Password != SecretMask {
+		t.Fatal("Secrets should be masked", regs)
+	}
+
+	// Sending back the mask keeps the secrets
+	data, _ := json.Marshal(reg)
+	res, err = doRequest("PUT", "/api/v1/registration/"+reg.ID.Hex(), string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("Update should succeed", res.StatusCode)
+	}
+	res, err = doRequest("PUT", "/api/v1/registration", `{"name":"secret","addressable":{"Password":"changed"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// Distro gets them through the internal endpoint
+	getJSON(t, "/api/v1/internal/registration/name/secret", &reg)
+	if reg.Addressable.Password != "changed" || reg.Encryption.Key != "key" || reg.Encryption.InitVector != "iv" {
+		t.Fatal("Secrets should be returned to distro", reg)
+	}
+	regs = nil
+	getJSON(t, "/api/v1/internal/registration", &regs)
+	if len(regs) != 1 || regs[0].Encryption.Key != "key" {
+		t.Fatal("Secrets should be returned to distro", regs)
+	}
+
+	// The mask can not be stored as a secret
+	res, err = doRequest("POST", "/api/v1/registration", strings.Replace(
+		strings.Replace(secretReg, `"secret"`, `"masked"`, 1), `"pass"`, `"`+SecretMask+`"`, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatal("Masked secret should be rejected", res.StatusCode)
+	}
+}
+
+func TestRollbackSecrets(t *testing.T) {
+	saved, savedHistory := repo, history
+	defer InitRepository(saved)
+	defer InitHistory(savedHistory)
+
+	keyring, _ := NewKeyring(masterKey('a'))
+	raw, rawHistory := memory.NewRepository(), memory.NewRepository()
+	InitRepository(NewSecretRepository(raw, keyring))
+	InitHistory(NewSecretHistory(rawHistory, keyring))
+
+	res, err := doRequest("POST", "/api/v1/registration", secretReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	id := string(data)
+
+	// Versions are stored encrypted and returned masked
+	stored, err := rawHistory.Version(id, 1)
+	if err != nil || !strings.HasPrefix(stored.Registration.Addressable.Password, "enc:default:") {
+		t.Fatal("Secret should be stored encrypted in the history", stored.Registration, err)
+	}
+	v := export.RegistrationVersion{}
+	getJSON(t, "/api/v1/registration/"+id+"/history/1", &v)
+	if v.Registration.Addressable.Password != SecretMask || v.Registration.Encryption.Key != SecretMask {
+		t.Fatal("Secrets should be masked", v.Registration)
+	}
+
+	// The deleted registration is restored with its secrets
+	res, err = doRequest("DELETE", "/api/v1/registration/name/secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = doRequest("POST", "/api/v1/registration/"+id+"/history/1/rollback", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatal("Rollback should restore the registration", res.StatusCode)
+	}
+	reg, err := repo.RegistrationByName("secret")
+	if err != nil || reg.Addressable.Password != "pass" || reg.Encryption.Key != "key" ||
+		reg.Encryption.InitVector != "iv" {
+		t.Fatal("Secrets should be restored", reg, err)
+	}
+	res, _ = doRequest("DELETE", "/api/v1/registration/name/secret", "")
+	res.Body.Close()
+}
@@ -21,21 +21,47 @@ func httpServer() http.Handler {
 	// Status
 	mux.Get("/status", http.HandlerFunc(getStatus))
 
-	// Registration
-	mux.Get("/api/v1/registration/:id", http.HandlerFunc(getRegByID))
-	mux.Get("/api/v1/registration/reference/:type", http.HandlerFunc(getRegList))
-	mux.Get("/api/v1/registration", http.HandlerFunc(getAllReg))
-	mux.Get("/api/v1/registration/name/:name", http.HandlerFunc(getRegByName))
-	mux.Post("/api/v1/registration", http.HandlerFunc(addReg))
-	mux.Put("/api/v1/registration", http.HandlerFunc(updateReg))
-	mux.Delete("/api/v1/registration/id/:id", http.HandlerFunc(delRegByID))
-	mux.Delete("/api/v1/registration/name/:name", http.HandlerFunc(delRegByName))
+	// Registration. bone matches the routes in order, so the static ones
+	// come before the ones with an id
+	mux.Get("/api/v1/registration/watch", authorize(RoleViewer, watchReg))
+	mux.Get("/api/v1/registration/export", authorize(RoleViewer, exportReg))
+	mux.Post("/api/v1/registration/import", authorize(RoleOperator, importReg))
+	mux.Get("/api/v1/registration/:id", authorize(RoleViewer, getRegByID))
+	mux.Get("/api/v1/registration/reference/:type", authorize(RoleViewer, getRegList))
+	mux.Get("/api/v1/capabilities", authorize(RoleViewer, getCapabilities))
+	mux.Get("/api/v1/registration", authorize(RoleViewer, getAllReg))
+	mux.Get("/api/v1/registration/name/:name", authorize(RoleViewer, getRegByName))
+	mux.Post("/api/v1/registration", authorize(RoleOperator, addReg))
+	mux.Put("/api/v1/registration", authorize(RoleOperator, updateReg))
+	mux.Put("/api/v1/registration/:id", authorize(RoleOperator, updateRegByID))
+	mux.Patch("/api/v1/registration/:id", authorize(RoleOperator, patchRegByID))
+	mux.Delete("/api/v1/registration/:id", authorize(RoleOperator, delRegByID))
+	mux.Delete("/api/v1/registration/id/:id", authorize(RoleOperator, delRegByID))
+	mux.Delete("/api/v1/registration/name/:name", authorize(RoleOperator, delRegByName))
+	mux.Post("/api/v1/registration/:name/test", authorize(RoleOperator, testReg))
+	mux.Get("/api/v1/registration/:name/status", authorize(RoleViewer, getRegStatus))
+	mux.Get("/api/v1/registration/:name/schema", authorize(RoleViewer, getRegSchema))
+
+	// History
+	mux.Get("/api/v1/registration/:id/history", authorize(RoleViewer, getRegHistory))
+	mux.Get("/api/v1/registration/:id/history/:version", authorize(RoleViewer, getRegVersion))
+	mux.Post("/api/v1/registration/:id/history/:version/rollback", authorize(RoleOperator, rollbackReg))
+
+	// Registrations with their secrets, for distro
+	mux.Get("/api/v1/internal/registration", authorize(RoleInternal, getAllRegInternal))
+	mux.Get("/api/v1/internal/registration/name/:name", authorize(RoleInternal, getRegByNameInternal))
+
+	// Audit
+	mux.Get("/api/v1/audit", authorize(RoleAdmin, getAudit))
 
 	return mux
 }
 
 func StartHTTPServer(config Config, errChan chan error) {
 	cfg = config
+	if cfg.RegistrationDir != "" {
+		go watchRegistrationDir(cfg.RegistrationDir, nil)
+	}
 	go func() {
 		p := fmt.Sprintf(":%d", cfg.Port)
 		logger.Info("Starting Export Client", zap.String("url", p))
@@ -9,11 +9,28 @@ package client
 import (
 	"io"
 	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-zoo/bone"
 )
 
+// Time allowed to distro to reply with the status of a registration
+const statusTimeout = 5 * time.Second
+
 func getStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	str := `{"running": true}`
 	io.WriteString(w, str)
 }
+
+// getRegStatus - status of the pipeline of a registration in distro: if it
+// runs, why it does not, and its counters of sent events and errors
+func getRegStatus(w http.ResponseWriter, r *http.Request) {
+	name := bone.GetValue(r, "name")
+
+	client := &http.Client{Timeout: statusTimeout}
+	response, err := client.Get(distroURL("/api/v1/status/" + url.PathEscape(name)))
+	replyFromDistro(w, response, err)
+}
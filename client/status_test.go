@@ -7,8 +7,12 @@
 package client
 
 import (
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 )
 
@@ -43,3 +47,40 @@ func TestGetStatus(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRegStatus(t *testing.T) {
+	distro := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/status/script" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"name":"script","running":false,"error":"script: failed"}`)
+	}))
+	defer distro.Close()
+
+	host, port, _ := net.SplitHostPort(distro.Listener.Addr().String())
+	saved := cfg
+	defer func() { cfg = saved }()
+	cfg.DistroHost = host
+	cfg.DistroPort, _ = strconv.Atoi(port)
+
+	res, err := doRequest("GET", "/api/v1/registration/script/status", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != `{"name":"script","running":false,"error":"script: failed"}` {
+		t.Fatal("Unexpected reply", res.StatusCode, string(body))
+	}
+
+	if res, _ = doRequest("GET", "/api/v1/registration/unknown/status", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatal("Unknown registration should not be found", res.StatusCode)
+	}
+
+	distro.Close()
+	if res, _ = doRequest("GET", "/api/v1/registration/script/status", ""); res.StatusCode != http.StatusBadGateway {
+		t.Fatal("Unreachable distro should be a bad gateway", res.StatusCode)
+	}
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2017
+// Mainflux
+// Cavium
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+const (
+	// Number of changes kept to resume watches
+	changeFeedSize = 1024
+
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+type change struct {
+	seq    uint64
+	update export.NotifyUpdate
+}
+
+// changeFeed - in memory log of registration changes. Tokens are made of an
+// epoch, that changes on every client restart, and a sequence number, so a
+// watcher can detect that it missed changes and has to resync
+type changeFeed struct {
+	mutex   sync.Mutex
+	epoch   string
+	seq     uint64
+	changes []change
+	// closed and replaced every time a change is published
+	wait chan struct{}
+}
+
+var feed = newChangeFeed()
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		wait:  make(chan struct{}),
+	}
+}
+
+func (f *changeFeed) token(seq uint64) string {
+	return f.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+func (f *changeFeed) publish(update export.NotifyUpdate) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.seq++
+	f.changes = append(f.changes, change{f.seq, update})
+	if len(f.changes) > changeFeedSize {
+		f.changes = f.changes[len(f.changes)-changeFeedSize:]
+	}
+
+	close(f.wait)
+	f.wait = make(chan struct{})
+}
+
+// since - returns the changes after the token, the token to resume from
+// and a channel closed on the next change. ok is false when the token can
+// not be resumed
+func (f *changeFeed) since(token string) (changes []export.NotifyUpdate,
+	next string, wait chan struct{}, ok bool) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if token == "" {
+		return nil, f.token(f.seq), f.wait, true
+	}
+
+	i := strings.LastIndex(token, "-")
+	if i < 0 || token[:i] != f.epoch {
+		return nil, "", nil, false
+	}
+	seq, err := strconv.ParseUint(token[i+1:], 10, 64)
+	if err != nil || seq > f.seq {
+		return nil, "", nil, false
+	}
+
+	// The first change after the token was already dropped from the log
+	if seq < f.seq && (len(f.changes) == 0 || f.changes[0].seq > seq+1) {
+		return nil, "", nil, false
+	}
+
+	for _, c := range f.changes {
+		if c.seq > seq {
+			changes = append(changes, c.update)
+		}
+	}
+	return changes, f.token(f.seq), f.wait, true
+}
+
+// watchReg - long poll for registration changes. Without a token it replies
+// immediately with the current token. With a token it waits until there are
+// changes after it or the timeout expires. 410 Gone is returned when the
+// token can not be resumed and the watcher has to fetch all registrations
+func watchReg(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	token := r.URL.Query().Get("token")
+
+	timeout := defaultWatchTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		secs, err := strconv.Atoi(t)
+		if err != nil || secs < 0 {
+			logger.Error("Invalid watch timeout", zap.String("timeout", t))
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Invalid timeout: "+t)
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+		if timeout > maxWatchTimeout {
+			timeout = maxWatchTimeout
+		}
+	}
+
+	changes, next, wait, ok := feed.since(token)
+	if ok && token != "" && len(changes) == 0 {
+		select {
+		case <-wait:
+			changes, next, _, ok = feed.since(token)
+		case <-time.After(timeout):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if !ok {
+		logger.Info("Watch token expired", zap.String("token", token))
+		w.WriteHeader(http.StatusGone)
+		io.WriteString(w, fmt.Sprintf("Token %s can not be resumed", token))
+		return
+	}
+
+	if changes == nil {
+		changes = []export.NotifyUpdate{}
+	}
+	res, err := json.Marshal(export.RegistrationChanges{Token: next, Changes: changes})
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(res))
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2017
+// Mainflux
+// Cavium
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drasko/edgex-export"
+)
+
+func TestChangeFeed(t *testing.T) {
+	f := newChangeFeed()
+
+	_, token, _, ok := f.since("")
+	if !ok {
+		t.Fatal("Empty token should always be accepted")
+	}
+
+	f.publish(export.NotifyUpdate{Name: "reg1", Operation: export.NotifyUpdateAdd})
+	f.publish(export.NotifyUpdate{Name: "reg2", Operation: export.NotifyUpdateAdd})
+
+	changes, next, _, ok := f.since(token)
+	if !ok || len(changes) != 2 {
+		t.Fatalf("Expected 2 changes got %d", len(changes))
+	}
+	if changes[0].Name != "reg1" || changes[1].Name != "reg2" {
+		t.Fatal("Changes are not ordered", changes)
+	}
+
+	changes, _, _, ok = f.since(next)
+	if !ok || len(changes) != 0 {
+		t.Fatal("There should be no changes after the last token")
+	}
+
+	for _, invalid := range []string{"invalid", "other-0", f.epoch + "-100"} {
+		if _, _, _, ok := f.since(invalid); ok {
+			t.Fatal("Token should not be resumed", invalid)
+		}
+	}
+
+	for i := 0; i < changeFeedSize; i++ {
+		f.publish(export.NotifyUpdate{Name: "reg", Operation: export.NotifyUpdateUpdate})
+	}
+	if _, _, _, ok := f.since(token); ok {
+		t.Fatal("Token older than the change log should not be resumed")
+	}
+}
+
+func TestWatchReg(t *testing.T) {
+	res, err := http.Get(ts.URL + "/api/v1/registration/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := export.RegistrationChanges{}
+	err = json.NewDecoder(res.Body).Decode(&changes)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || changes.Token == "" {
+		t.Fatal("Expected a token got", res.StatusCode, changes.Token)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		notifyUpdatedRegistrations(export.NotifyUpdate{Name: "watched", Operation: export.NotifyUpdateAdd})
+	}()
+
+	res, err = http.Get(ts.URL + "/api/v1/registration/watch?timeout=5&token=" + changes.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewDecoder(res.Body).Decode(&changes)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changes) != 1 || changes.Changes[0].Name != "watched" {
+		t.Fatal("Expected the watched change got", changes.Changes)
+	}
+
+	res, err = http.Get(ts.URL + "/api/v1/registration/watch?token=invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusGone {
+		t.Fatalf("Expected status %d got %d", http.StatusGone, res.StatusCode)
+	}
+}
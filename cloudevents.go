@@ -0,0 +1,23 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// CloudEvents content modes
+const (
+	CloudEventsStructured = "structured"
+	CloudEventsBinary     = "binary"
+)
+
+// CloudEventsDetails - CloudEvents 1.0 envelope of the payloads of any
+// format. Structured mode sends the envelope as a JSON document with the
+// payload in it, binary mode the payload with ce-* HTTP headers, which
+// needs a REST destination. Source is the gateway part of the source of
+// the events, "<source>/<device>", the host name by default
+type CloudEventsDetails struct {
+	Mode   string `bson:"mode,omitempty" json:"mode,omitempty"`
+	Source string `bson:"source,omitempty" json:"source,omitempty"`
+}
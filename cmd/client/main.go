@@ -16,7 +16,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/drasko/edgex-export/boltdb"
 	"github.com/drasko/edgex-export/client"
+	"github.com/drasko/edgex-export/memory"
 	"github.com/drasko/edgex-export/mongo"
 
 	"go.uber.org/zap"
@@ -32,12 +34,37 @@ const (
 	defMongoPort           int    = 27017
 	defMongoConnectTimeout int    = 5000
 	defMongoSocketTimeout  int    = 5000
+	defDatabase            string = dbMongo
+	defBoltPath            string = "export-client.db"
 	envMongoURL            string = "EXPORT_CLIENT_MONGO_URL"
+	envDatabase            string = "EXPORT_CLIENT_DB"
+	envBoltPath            string = "EXPORT_CLIENT_BOLT_PATH"
 	envDistroHost          string = "EXPORT_CLIENT_DISTRO_HOST"
+	envDistroPort          string = "EXPORT_CLIENT_DISTRO_PORT"
+	envNotifyDistro        string = "EXPORT_CLIENT_NOTIFY_DISTRO"
+	envAPIKeysFile         string = "EXPORT_CLIENT_API_KEYS_FILE"
+	envHMACKeysFile        string = "EXPORT_CLIENT_HMAC_KEYS_FILE"
+	envJWKSFile            string = "EXPORT_CLIENT_JWKS_FILE"
+	envJWTIssuer           string = "EXPORT_CLIENT_JWT_ISSUER"
+	envJWTAudience         string = "EXPORT_CLIENT_JWT_AUDIENCE"
+	envMasterKey           string = "EXPORT_CLIENT_MASTER_KEY"
+	envMasterKeyFile       string = "EXPORT_CLIENT_MASTER_KEY_FILE"
+	envRegistrationDir     string = "EXPORT_CLIENT_REGISTRATION_DIR"
+)
+
+// Supported databases
+const (
+	dbMongo  = "mongo"
+	dbBolt   = "bolt"
+	dbMemory = "memory"
 )
 
 type config struct {
 	Port                int
+	Database            string
+	BoltPath            string
+	MasterKey           string
+	MasterKeyFile       string
 	MongoURL            string
 	MongoUser           string
 	MongoPass           string
@@ -55,15 +82,62 @@ func main() {
 
 	client.InitLogger(logger)
 
-	ms, err := connectToMongo(cfg)
+	if err := client.InitAuth(clientCfg.Auth); err != nil {
+		logger.Error("Failed to load credentials.", zap.Error(err))
+		return
+	}
+
+	keyring, err := loadKeyring(cfg)
 	if err != nil {
-		logger.Error("Failed to connect to Mongo.", zap.Error(err))
+		logger.Error("Failed to load master key.", zap.Error(err))
+		return
+	}
+
+	var repo client.RegistrationRepository
+	var history client.HistoryRepository
+	switch cfg.Database {
+	case dbMongo:
+		ms, err := connectToMongo(cfg)
+		if err != nil {
+			logger.Error("Failed to connect to Mongo.", zap.Error(err))
+			return
+		}
+		defer ms.Close()
+
+		mongoRepo := mongo.NewRepository(ms)
+		repo, history = mongoRepo, mongoRepo
+	case dbBolt:
+		boltRepo, err := boltdb.NewRepository(cfg.BoltPath)
+		if err != nil {
+			logger.Error("Failed to open Bolt database.", zap.Error(err))
+			return
+		}
+		defer boltRepo.Close()
+
+		repo, history = boltRepo, boltRepo
+	case dbMemory:
+		logger.Warn("Registrations will be lost on restart")
+		memRepo := memory.NewRepository()
+		repo, history = memRepo, memRepo
+	default:
+		logger.Error("Unknown database", zap.String("database", cfg.Database))
 		return
 	}
-	defer ms.Close()
 
-	repo := mongo.NewRepository(ms)
-	client.InitMongoRepository(repo)
+	if keyring != nil {
+		repo = client.NewSecretRepository(repo, keyring)
+		history = client.NewSecretHistory(history, keyring)
+		n, err := client.RotateSecrets(repo)
+		if err != nil {
+			logger.Error("Failed to encrypt stored secrets.", zap.Error(err))
+			return
+		}
+		logger.Info("Encrypted stored secrets with the primary master key", zap.Int("registrations", n))
+	} else {
+		logger.Warn("No master key, registration secrets are stored in plaintext")
+	}
+	client.InitRepository(repo)
+	client.InitHistory(history)
 
 	errs := make(chan error, 2)
 
@@ -82,6 +156,10 @@ func main() {
 func loadConfig() (*config, *client.Config) {
 
 	cfg := config{
+		Database:            env(envDatabase, defDatabase),
+		BoltPath:            env(envBoltPath, defBoltPath),
+		MasterKey:           env(envMasterKey, ""),
+		MasterKeyFile:       env(envMasterKeyFile, ""),
 		MongoURL:            env(envMongoURL, defMongoURL),
 		MongoUser:           defMongoUsername,
 		MongoPass:           defMongoPassword,
@@ -93,10 +171,34 @@ func loadConfig() (*config, *client.Config) {
 
 	clientCfg := client.GetDefaultConfig()
 	clientCfg.DistroHost = env(envDistroHost, clientCfg.DistroHost)
+	if port, err := strconv.Atoi(env(envDistroPort, "")); err == nil {
+		clientCfg.DistroPort = port
+	}
+	clientCfg.NotifyDistro, _ = strconv.ParseBool(env(envNotifyDistro, "false"))
+	clientCfg.RegistrationDir = env(envRegistrationDir, "")
+	clientCfg.Auth = client.AuthConfig{
+		APIKeysFile:  env(envAPIKeysFile, ""),
+		HMACKeysFile: env(envHMACKeysFile, ""),
+		JWKSFile:     env(envJWKSFile, ""),
+		JWTIssuer:    env(envJWTIssuer, ""),
+		JWTAudience:  env(envJWTAudience, ""),
+	}
 
 	return &cfg, &clientCfg
 }
 
+// loadKeyring - master keys from the keyring file or, without it, the
+// single key in the environment. It returns nil if none is set
+func loadKeyring(cfg *config) (*client.Keyring, error) {
+	if cfg.MasterKeyFile != "" {
+		return client.LoadKeyring(cfg.MasterKeyFile)
+	}
+	if cfg.MasterKey != "" {
+		return client.NewKeyring(cfg.MasterKey)
+	}
+	return nil, nil
+}
+
 func env(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -23,6 +23,8 @@ import (
 const (
 	envClientHost string = "EXPORT_DISTRO_CLIENT_HOST"
 	envDataHost   string = "EXPORT_DISTRO_DATA_HOST"
+	envAPIKey     string = "EXPORT_DISTRO_CLIENT_API_KEY"
+	envRegDir     string = "EXPORT_DISTRO_REGISTRATION_DIR"
 )
 
 var logger *zap.Logger
@@ -57,6 +59,8 @@ func loadConfig() distro.Config {
 	cfg := distro.GetDefaultConfig()
 	cfg.ClientHost = env(envClientHost, cfg.ClientHost)
 	cfg.DataHost = env(envDataHost, cfg.DataHost)
+	cfg.ClientAPIKey = env(envAPIKey, cfg.ClientAPIKey)
+	cfg.RegistrationDir = env(envRegDir, cfg.RegistrationDir)
 	return cfg
 }
 
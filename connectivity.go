@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Causes of failed connectivity tests
+const (
+	CauseDNS         = "dns"
+	CauseRefused     = "connection_refused"
+	CauseTimeout     = "timeout"
+	CauseTLS         = "tls"
+	CauseAuth        = "auth"
+	CauseRejected    = "rejected"
+	CauseNetwork     = "network"
+	CauseUnsupported = "unsupported"
+)
+
+// ConnectivityResult - outcome of opening a connection with the destination
+// of a registration. Latency is the time taken by all the steps, in
+// milliseconds. Cause classifies the error of failed tests
+type ConnectivityResult struct {
+	Registration string             `json:"registration"`
+	Destination  string             `json:"destination"`
+	Target       string             `json:"target"`
+	Success      bool               `json:"success"`
+	Latency      float64            `json:"latency"`
+	Steps        []ConnectivityStep `json:"steps"`
+	TLS          *TLSDetails        `json:"tls,omitempty"`
+	Cause        string             `json:"cause,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// ConnectivityStep - single step of a connectivity test, as in "connect"
+// or "publish", with its latency in milliseconds
+type ConnectivityStep struct {
+	Name    string  `json:"name"`
+	Success bool    `json:"success"`
+	Latency float64 `json:"latency"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// TLSDetails - TLS connection negotiated with the destination
+type TLSDetails struct {
+	Version      string            `json:"version"`
+	CipherSuite  string            `json:"cipherSuite"`
+	ServerName   string            `json:"serverName,omitempty"`
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+}
+
+// CertificateInfo - certificate presented by the destination. NotBefore and
+// NotAfter are in milliseconds since the epoch
+type CertificateInfo struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	DNSNames  []string `json:"dnsNames,omitempty"`
+	NotBefore int64    `json:"notBefore"`
+	NotAfter  int64    `json:"notAfter"`
+}
@@ -0,0 +1,350 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+)
+
+const (
+	mimeTypeAvro = "avro/binary"
+	// Headers identifying the schema of the payloads
+	avroFingerprintHeader = "Avro-Schema-Fingerprint"
+	avroVersionHeader     = "Avro-Schema-Version"
+	// Version of avroEventSchema, incremented with every change of the
+	// schema
+	avroSchemaVersion = 1
+	// Empty fingerprint of CRC-64-AVRO
+	avroEmptyFingerprint uint64 = 0xc15d213aa4d7a795
+	avroSyncSize                = 16
+	// Size of the blocks of the container files before compression, the
+	// sync interval of the Avro writers
+	avroBlockSize = 64 * 1024
+	// Time an event waits for its batch to be full if the registration
+	// does not set it
+	defaultAvroBatchInterval = time.Second
+)
+
+// avroEventSchema - schema of export.Event, in Parsing Canonical Form so
+// the fingerprint is the one consumers compute. Fields have the names of
+// the JSON format, and missing strings are empty
+const avroEventSchema = `{"name":"org.edgexfoundry.export.Event","type":"record","fields":[` +
+	`{"name":"id","type":"string"},` +
+	`{"name":"pushed","type":"long"},` +
+	`{"name":"device","type":"string"},` +
+	`{"name":"readings","type":{"type":"array","items":` +
+	`{"name":"org.edgexfoundry.export.Reading","type":"record","fields":[` +
+	`{"name":"id","type":"string"},` +
+	`{"name":"pushed","type":"long"},` +
+	`{"name":"name","type":"string"},` +
+	`{"name":"value","type":"string"},` +
+	`{"name":"device","type":"string"},` +
+	`{"name":"created","type":"long"},` +
+	`{"name":"modified","type":"long"},` +
+	`{"name":"origin","type":"long"}]}}},` +
+	`{"name":"created","type":"long"},` +
+	`{"name":"modified","type":"long"},` +
+	`{"name":"origin","type":"long"}]}`
+
+var (
+	// Magic bytes of single object encoding and object container files
+	avroSingleObjectMagic = []byte{0xc3, 0x01}
+	avroContainerMagic    = []byte{'O', 'b', 'j', 1}
+
+	avroFingerprintTable = func() (table [256]uint64) {
+		for i := range table {
+			fp := uint64(i)
+			for j := 0; j < 8; j++ {
+				fp = (fp >> 1) ^ (avroEmptyFingerprint & -(fp & 1))
+			}
+			table[i] = fp
+		}
+		return table
+	}()
+	avroFingerprint = avroRabin([]byte(avroEventSchema))
+)
+
+// AvroSchema - published schema of the Avro formats. Fingerprint is the
+// CRC-64-AVRO fingerprint of the schema, in hex
+type AvroSchema struct {
+	Version     int             `json:"version"`
+	Fingerprint string          `json:"fingerprint"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// avroRabin - CRC-64-AVRO fingerprint of a schema
+func avroRabin(schema []byte) uint64 {
+	fp := avroEmptyFingerprint
+	for _, b := range schema {
+		fp = (fp >> 8) ^ avroFingerprintTable[byte(fp)^b]
+	}
+	return fp
+}
+
+func avroFingerprintHex() string {
+	return fmt.Sprintf("%016x", avroFingerprint)
+}
+
+// Binary encoding of the values of the schema. Longs are zig-zag varints,
+// as encoding/binary writes them
+func avroLong(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func avroString(buf *bytes.Buffer, s string) {
+	avroLong(buf, int64(len(s)))
+	buf.WriteString(s)
+}
+
+func avroBytes(buf *bytes.Buffer, b []byte) {
+	avroLong(buf, int64(len(b)))
+	buf.Write(b)
+}
+
+// avroEvent - binary encoding of an event with avroEventSchema
+func avroEvent(buf *bytes.Buffer, event *export.Event) {
+	avroString(buf, event.ID)
+	avroLong(buf, event.Pushed)
+	avroString(buf, event.Device)
+	if len(event.Readings) > 0 {
+		// Arrays are written as a single block
+		avroLong(buf, int64(len(event.Readings)))
+		for _, r := range event.Readings {
+			avroString(buf, r.ID)
+			avroLong(buf, r.Pushed)
+			avroString(buf, r.Name)
+			avroString(buf, r.Value)
+			avroString(buf, r.Device)
+			avroLong(buf, r.Created)
+			avroLong(buf, r.Modified)
+			avroLong(buf, r.Origin)
+		}
+	}
+	avroLong(buf, 0)
+	avroLong(buf, event.Created)
+	avroLong(buf, event.Modified)
+	avroLong(buf, event.Origin)
+}
+
+// avroHeaders - headers of the Avro payloads, identifying the schema
+func avroHeaders() map[string]string {
+	return map[string]string{
+		"Content-Type":        mimeTypeAvro,
+		avroFingerprintHeader: avroFingerprintHex(),
+		avroVersionHeader:     strconv.Itoa(avroSchemaVersion),
+	}
+}
+
+// avroFormater - Avro format of the events, in single object encoding or,
+// if container is set, as object container files
+type avroFormater struct {
+	container bool
+	codec     string
+	sync      [avroSyncSize]byte
+}
+
+func newAvroFormater(reg export.Registration) (Formater, error) {
+	return avroFormater{}, nil
+}
+
+func newAvroContainerFormater(reg export.Registration) (Formater, error) {
+	f := avroFormater{container: true, codec: export.AvroCodecNull}
+	if reg.Avro != nil && reg.Avro.Codec != "" {
+		f.codec = reg.Avro.Codec
+	}
+	if _, err := avroCompress(f.codec, nil); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(f.sync[:]); err != nil {
+		return nil, err
+	}
+	if reg.Avro == nil || reg.Avro.BatchSize <= 1 {
+		return f, nil
+	}
+
+	b := &avroBatchFormater{
+		avroFormater: f,
+		size:         reg.Avro.BatchSize,
+		interval:     defaultAvroBatchInterval,
+	}
+	if reg.Avro.BatchInterval > 0 {
+		b.interval = time.Duration(reg.Avro.BatchInterval) * time.Millisecond
+	}
+	return b, nil
+}
+
+func (f avroFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Error("Error encoding Avro event", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - encoded event, with the fingerprint and version of its
+// schema in the headers
+func (f avroFormater) FormatMessage(event *export.Event) (Message, error) {
+	var buf bytes.Buffer
+	if f.container {
+		if err := writeAvroContainer(&buf, f.codec, f.sync, []*export.Event{event}); err != nil {
+			return Message{}, err
+		}
+	} else {
+		buf.Write(avroSingleObjectMagic)
+		binary.Write(&buf, binary.LittleEndian, avroFingerprint)
+		avroEvent(&buf, event)
+	}
+	return Message{Data: buf.Bytes(), Headers: avroHeaders()}, nil
+}
+
+// avroBatchFormater - object container files of batches of events. The
+// files of a registration have the same sync marker
+type avroBatchFormater struct {
+	avroFormater
+	size     int
+	interval time.Duration
+	events   []*export.Event
+}
+
+func (f *avroBatchFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Error("Error encoding Avro event", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - add event to the batch, returning the file of the batch
+// once it is full
+func (f *avroBatchFormater) FormatMessage(event *export.Event) (Message, error) {
+	f.events = append(f.events, event)
+	if len(f.events) < f.size {
+		return Message{}, nil
+	}
+	return f.Flush()
+}
+
+func (f *avroBatchFormater) Pending() int {
+	return len(f.events)
+}
+
+// Flush - file of the pending events, and a nil Data without any
+func (f *avroBatchFormater) Flush() (Message, error) {
+	if len(f.events) == 0 {
+		return Message{}, nil
+	}
+	events := f.events
+	f.events = nil
+
+	var buf bytes.Buffer
+	if err := writeAvroContainer(&buf, f.codec, f.sync, events); err != nil {
+		return Message{}, err
+	}
+	return Message{Data: buf.Bytes(), Headers: avroHeaders()}, nil
+}
+
+func (f *avroBatchFormater) Interval() time.Duration {
+	return f.interval
+}
+
+// avroCompress - block data compressed with codec
+func avroCompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case export.AvroCodecNull:
+		return data, nil
+	case export.AvroCodecDeflate:
+		// Raw deflate, with no zlib header
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case export.AvroCodecSnappy:
+		// Snappy block followed by the big endian CRC32 of the data
+		var crc [4]byte
+		binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(data))
+		return append(snappy.Encode(nil, data), crc[:]...), nil
+	}
+	return nil, errors.New("unknown Avro codec " + codec)
+}
+
+// writeAvroContainer - object container file of events, in blocks of about
+// avroBlockSize bytes compressed with codec, each followed by the sync
+// marker
+func writeAvroContainer(w io.Writer, codec string, sync [avroSyncSize]byte, events []*export.Event) error {
+	var buf bytes.Buffer
+	buf.Write(avroContainerMagic)
+	// File metadata, a map of bytes
+	avroLong(&buf, 2)
+	avroString(&buf, "avro.schema")
+	avroBytes(&buf, []byte(avroEventSchema))
+	avroString(&buf, "avro.codec")
+	avroBytes(&buf, []byte(codec))
+	avroLong(&buf, 0)
+	buf.Write(sync[:])
+
+	var block bytes.Buffer
+	count := 0
+	for i, event := range events {
+		avroEvent(&block, event)
+		count++
+		if block.Len() < avroBlockSize && i < len(events)-1 {
+			continue
+		}
+
+		data, err := avroCompress(codec, block.Bytes())
+		if err != nil {
+			return err
+		}
+		avroLong(&buf, int64(count))
+		avroBytes(&buf, data)
+		buf.Write(sync[:])
+		block.Reset()
+		count = 0
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// getAvroSchema - schema of the Avro formats, for consumers resolving the
+// fingerprint of the payloads
+func getAvroSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(AvroSchema{
+		Version:     avroSchemaVersion,
+		Fingerprint: avroFingerprintHex(),
+		Schema:      json.RawMessage(avroEventSchema),
+	})
+	if err != nil {
+		logger.Error("Failed to marshal Avro schema", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", mimeTypeJSON)
+	w.Write(data)
+}
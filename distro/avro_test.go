@@ -0,0 +1,329 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+)
+
+// avroReader - decoder of the values of avroEventSchema
+type avroReader struct {
+	t    *testing.T
+	data *bytes.Reader
+}
+
+func (r avroReader) long() int64 {
+	v, err := binary.ReadVarint(r.data)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return v
+}
+
+func (r avroReader) bytes() []byte {
+	b := make([]byte, r.long())
+	if _, err := r.data.Read(b); err != nil && len(b) > 0 {
+		r.t.Fatal(err)
+	}
+	return b
+}
+
+func (r avroReader) string() string {
+	return string(r.bytes())
+}
+
+func (r avroReader) event() export.Event {
+	e := export.Event{ID: r.string(), Pushed: r.long(), Device: r.string()}
+	for n := r.long(); n != 0; n = r.long() {
+		for ; n > 0; n-- {
+			e.Readings = append(e.Readings, export.Reading{ID: r.string(), Pushed: r.long(), Name: r.string(),
+				Value: r.string(), Device: r.string(), Created: r.long(), Modified: r.long(), Origin: r.long()})
+		}
+	}
+	e.Created, e.Modified, e.Origin = r.long(), r.long(), r.long()
+	return e
+}
+
+func TestAvroFingerprint(t *testing.T) {
+	// Fingerprint of the Avro specification test suite
+	if fp := avroRabin([]byte(`"string"`)); fp != 0x8f014872634503c7 {
+		t.Fatalf("Unexpected fingerprint %x", fp)
+	}
+	if err := json.Unmarshal([]byte(avroEventSchema), &map[string]interface{}{}); err != nil {
+		t.Fatal("Schema should be JSON", err)
+	}
+}
+
+func TestAvroSingleObject(t *testing.T) {
+	f, err := newFormater(export.Registration{Format: export.FormatAvro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := formatEvent()
+	msg, err := f.(MessageFormater).FormatMessage(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers["Content-Type"] != mimeTypeAvro || msg.Headers[avroVersionHeader] != "1" ||
+		msg.Headers[avroFingerprintHeader] != avroFingerprintHex() {
+		t.Fatal("Unexpected headers", msg.Headers)
+	}
+
+	if !bytes.HasPrefix(msg.Data, avroSingleObjectMagic) ||
+		binary.LittleEndian.Uint64(msg.Data[2:10]) != avroFingerprint {
+		t.Fatal("Unexpected single object header", msg.Data[:10])
+	}
+	r := avroReader{t, bytes.NewReader(msg.Data[10:])}
+	if decoded := r.event(); !reflect.DeepEqual(decoded, *event) || r.data.Len() != 0 {
+		t.Fatal("Event should round trip", decoded)
+	}
+}
+
+// readAvroContainer - metadata and events of an object container file,
+// checking the sync marker after the header and each block
+func readAvroContainer(t *testing.T, data []byte, sync []byte, decompress func([]byte) []byte) (map[string]string, []export.Event, int) {
+	if !bytes.HasPrefix(data, avroContainerMagic) {
+		t.Fatal("Unexpected magic")
+	}
+	r := avroReader{t, bytes.NewReader(data[len(avroContainerMagic):])}
+	meta := map[string]string{}
+	for n := r.long(); n != 0; n = r.long() {
+		for ; n > 0; n-- {
+			meta[r.string()] = string(r.bytes())
+		}
+	}
+	marker := make([]byte, avroSyncSize)
+	r.data.Read(marker)
+	if sync != nil && !bytes.Equal(marker, sync) {
+		t.Fatal("Unexpected sync marker", marker)
+	}
+	sync = marker
+
+	var events []export.Event
+	blocks := 0
+	for ; r.data.Len() > 0; blocks++ {
+		n := r.long()
+		block := avroReader{t, bytes.NewReader(decompress(r.bytes()))}
+		for ; n > 0; n-- {
+			events = append(events, block.event())
+		}
+		if block.data.Len() != 0 {
+			t.Fatal("Unexpected block count")
+		}
+		r.data.Read(marker)
+		if !bytes.Equal(marker, sync) {
+			t.Fatal("Block should end with the sync marker")
+		}
+	}
+	return meta, events, blocks
+}
+
+func TestAvroContainer(t *testing.T) {
+	events := []*export.Event{formatEvent(), {Device: "dev2", Origin: 1500000000000}, formatEvent()}
+	sync := [avroSyncSize]byte{1, 2, 3}
+
+	decompress := map[string]func([]byte) []byte{
+		export.AvroCodecNull: func(b []byte) []byte { return b },
+		export.AvroCodecDeflate: func(b []byte) []byte {
+			data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		},
+		export.AvroCodecSnappy: func(b []byte) []byte {
+			data, err := snappy.Decode(nil, b[:len(b)-4])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(b[len(b)-4:]) {
+				t.Fatal("Unexpected checksum")
+			}
+			return data
+		},
+	}
+	for codec, decompress := range decompress {
+		var buf bytes.Buffer
+		if err := writeAvroContainer(&buf, codec, sync, events); err != nil {
+			t.Fatal(codec, err)
+		}
+
+		meta, decoded, blocks := readAvroContainer(t, buf.Bytes(), sync[:], decompress)
+		if meta["avro.schema"] != avroEventSchema || meta["avro.codec"] != codec {
+			t.Fatal("Unexpected metadata", codec, meta)
+		}
+		if blocks != 1 || len(decoded) != len(events) {
+			t.Fatal("Unexpected blocks", codec, blocks, len(decoded))
+		}
+		for i, event := range events {
+			if !reflect.DeepEqual(decoded[i], *event) {
+				t.Fatal("Event should round trip", codec, decoded[i])
+			}
+		}
+	}
+
+	// Large batches are split in blocks
+	events = nil
+	for i := 0; i < 1000; i++ {
+		events = append(events, formatEvent())
+	}
+	var buf bytes.Buffer
+	if err := writeAvroContainer(&buf, export.AvroCodecNull, sync, events); err != nil {
+		t.Fatal(err)
+	}
+	_, decoded, blocks := readAvroContainer(t, buf.Bytes(), sync[:], decompress[export.AvroCodecNull])
+	if blocks < 2 || len(decoded) != len(events) || !reflect.DeepEqual(decoded[999], *events[999]) {
+		t.Fatal("Unexpected blocks", blocks, len(decoded))
+	}
+}
+
+func TestAvroContainerFormat(t *testing.T) {
+	reg := export.Registration{Format: export.FormatAvroOCF, Avro: &export.AvroDetails{Codec: export.AvroCodecSnappy}}
+	f, err := newFormater(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := f.Format(formatEvent())
+	second := f.Format(formatEvent())
+	if !bytes.HasPrefix(first, avroContainerMagic) || !bytes.Equal(first, second) {
+		t.Fatal("Files of a registration should have the same sync marker")
+	}
+
+	reg.Avro.Codec = "bzip2"
+	if _, err := newFormater(reg); err == nil {
+		t.Fatal("Unknown codec should be rejected")
+	}
+}
+
+func TestAvroBatch(t *testing.T) {
+	reg := export.Registration{Format: export.FormatAvroOCF, Avro: &export.AvroDetails{BatchSize: 3}}
+	f, err := newFormater(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := f.(BatchFormater)
+	if b.Interval() != defaultAvroBatchInterval {
+		t.Fatal("Unexpected interval", b.Interval())
+	}
+
+	for i := 0; i < 2; i++ {
+		if msg, err := b.FormatMessage(formatEvent()); err != nil || msg.Data != nil {
+			t.Fatal("Events should wait for the batch to be full", msg, err)
+		}
+	}
+	full, err := b.FormatMessage(&export.Event{Device: "dev2"})
+	if err != nil || b.Pending() != 0 || full.Headers[avroFingerprintHeader] != avroFingerprintHex() {
+		t.Fatal("Full batch should be written", full, err)
+	}
+	null := func(b []byte) []byte { return b }
+	_, events, _ := readAvroContainer(t, full.Data, nil, null)
+	if len(events) != 3 || events[2].Device != "dev2" {
+		t.Fatal("Unexpected events", events)
+	}
+
+	b.FormatMessage(formatEvent())
+	flushed, err := b.Flush()
+	if err != nil || b.Pending() != 0 {
+		t.Fatal("Pending events should be flushed", err)
+	}
+	// The files of the registration share the sync marker
+	sync := full.Data[len(full.Data)-avroSyncSize:]
+	if _, events, _ = readAvroContainer(t, flushed.Data, sync, null); len(events) != 1 {
+		t.Fatal("Unexpected events", events)
+	}
+	if msg, _ := b.Flush(); msg.Data != nil {
+		t.Fatal("Flush without pending events should have no payload")
+	}
+}
+
+type chanSender chan []byte
+
+func (s chanSender) Send(data []byte) {
+	s <- data
+}
+
+func TestAvroBatchLoop(t *testing.T) {
+	logger = zap.NewNop()
+
+	reg := validRegistration()
+	reg.Name = "avro-batch"
+	reg.Format = export.FormatAvroOCF
+	reg.Avro = &export.AvroDetails{BatchSize: 10, BatchInterval: 10}
+	reg.Filter = export.Filter{}
+	defer statusDeleted(reg.Name)
+
+	ri := newRegistrationInfo()
+	if !ri.update(reg) {
+		t.Fatal("Registration should be valid")
+	}
+	sender := make(chanSender, 1)
+	ri.sender = sender
+	done := make(chan struct{})
+	go func() {
+		registrationLoop(ri)
+		close(done)
+	}()
+
+	received := func() []export.Event {
+		select {
+		case data := <-sender:
+			_, events, _ := readAvroContainer(t, data, nil, func(b []byte) []byte { return b })
+			return events
+		case <-time.After(time.Second):
+			t.Fatal("Batch should be sent")
+		}
+		return nil
+	}
+
+	// Sent after the interval
+	ri.chEvent <- formatEvent()
+	ri.chEvent <- formatEvent()
+	if events := received(); len(events) != 2 {
+		t.Fatal("Unexpected batch", len(events))
+	}
+
+	// Sent before terminating
+	ri.chEvent <- formatEvent()
+	ri.chRegistration <- nil
+	if events := received(); len(events) != 1 {
+		t.Fatal("Unexpected batch", len(events))
+	}
+	<-done
+}
+
+func TestGetAvroSchema(t *testing.T) {
+	ts := httptest.NewServer(httpServer())
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL + "/api/v1/schema/avro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	schema := AvroSchema{}
+	if err := json.NewDecoder(response.Body).Decode(&schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != avroSchemaVersion || schema.Fingerprint != avroFingerprintHex() ||
+		string(schema.Schema) != avroEventSchema {
+		t.Fatal("Unexpected schema", schema)
+	}
+}
@@ -0,0 +1,44 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+// capabilities - registered formats, compressions, algorithms,
+// destinations and filters
+func capabilities() export.Capabilities {
+	return export.Capabilities{
+		Formats:      formats.capabilities(),
+		Compressions: compressions.capabilities(),
+		Algorithms:   algorithms.capabilities(),
+		Destinations: destinations.capabilities(),
+		Filters:      filters.capabilities(),
+	}
+}
+
+// getCapabilities - reply with the capabilities document, so the client
+// only accepts registrations distro can export
+func getCapabilities(w http.ResponseWriter, r *http.Request) {
+	res, err := json.Marshal(capabilities())
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+// Every capability published must be handled by registrationInfo.update
+func TestCapabilitiesSupported(t *testing.T) {
+	logger = zap.NewNop()
+
+	base := export.Registration{
+		Name:        "caps",
+		Format:      export.FormatJSON,
+		Destination: export.DestMQTT,
+		Addressable: export.Addressable{Address: "127.0.0.1", Port: 1883, Topic: "topic", Method: export.MethodPost, Password: "token"},
+		Encryption:  export.EncryptionDetails{Key: "key", InitVector: "iv"},
+		Script:      &export.ScriptDetails{Source: "function transform(e) return '' end"},
+		Template:    &export.TemplateDetails{Source: "{{.Device}}"},
+		Influx:      &export.InfluxDetails{Bucket: "bucket", Org: "org"},
+		Sparkplug:   &export.SparkplugDetails{GroupID: "group", NodeID: "node"},
+	}
+
+	caps := capabilities()
+	stages := []struct {
+		caps []export.Capability
+		set  func(reg *export.Registration, name string)
+	}{
+		{caps.Formats, func(reg *export.Registration, name string) { reg.Format = name }},
+		{caps.Compressions, func(reg *export.Registration, name string) { reg.Compression = name }},
+		{caps.Algorithms, func(reg *export.Registration, name string) { reg.Encryption.Algo = name }},
+		{caps.Destinations, func(reg *export.Registration, name string) { reg.Destination = name }},
+	}
+	for _, s := range stages {
+		for _, c := range s.caps {
+			reg := base
+			s.set(&reg, c.Name)
+			if err := reg.ValidateWith(caps); err != nil {
+				t.Fatal("Registration should be valid", c.Name, err)
+			}
+			regInfo := newRegistrationInfo()
+			if !regInfo.update(reg) || regInfo.format == nil || regInfo.sender == nil {
+				t.Fatal("Capability not handled", c.Name)
+			}
+		}
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/capabilities", nil)
+	w := httptest.NewRecorder()
+	httpServer().ServeHTTP(w, r)
+
+	caps := export.Capabilities{}
+	if err := json.Unmarshal(w.Body.Bytes(), &caps); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(caps.Formats) != len(capabilities().Formats) ||
+		len(caps.Destinations[0].Parameters) == 0 {
+		t.Fatal("Unexpected capabilities", w.Code, caps)
+	}
+}
@@ -18,26 +18,54 @@ import (
 
 const (
 	clientPort int = 48071
+	// Header with the API key used to authenticate with the client
+	apiKeyHeader = "X-API-Key"
 )
 
+// clientGet - GET request to the client with client, authenticated with the
+// configured API key
+func clientGet(client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ClientAPIKey != "" {
+		req.Header.Set(apiKeyHeader, cfg.ClientAPIKey)
+	}
+	return client.Do(req)
+}
+
 func getRegistrationBaseURL(host string) string {
 	return "http://" + host + ":" + strconv.Itoa(clientPort) +
 		"/api/v1/registration"
 }
 
+// getInternalRegistrationURL - registrations with their secrets, which the
+// client masks in the public endpoints
+func getInternalRegistrationURL(host string) string {
+	return "http://" + host + ":" + strconv.Itoa(clientPort) +
+		"/api/v1/internal/registration"
+}
+
 func getRegistrations() []export.Registration {
-	url := getRegistrationBaseURL(cfg.ClientHost)
+	url := getInternalRegistrationURL(cfg.ClientHost)
 	return getRegistrationsURL(url)
 }
 
 func getRegistrationsURL(url string) []export.Registration {
-	response, err := http.Get(url)
+	response, err := clientGet(http.DefaultClient, url)
 	if err != nil {
 		logger.Warn("Error getting all registrations", zap.String("url", url))
 		return nil
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		logger.Warn("Error getting all registrations", zap.String("url", url),
+			zap.String("status", response.Status))
+		return nil
+	}
+
 	registrations := []export.Registration{}
 	if err := json.NewDecoder(response.Body).Decode(&registrations); err != nil {
 		logger.Warn("Could not parse json", zap.Error(err))
@@ -46,35 +74,43 @@ func getRegistrationsURL(url string) []export.Registration {
 
 	results := registrations[:0]
 	for _, reg := range registrations {
-		if reg.Validate() {
-			results = append(results, reg)
+		if err := reg.ValidateWith(capabilities()); err != nil {
+			logger.Warn("Ignoring invalid registration", zap.String("name", reg.Name), zap.Error(err))
+			continue
 		}
+		results = append(results, reg)
 	}
 	return results
 }
 
 func getRegistrationByName(name string) *export.Registration {
-	url := getRegistrationBaseURL(cfg.ClientHost) + "/name/" + name
+	url := getInternalRegistrationURL(cfg.ClientHost) + "/name/" + name
 	return getRegistrationByNameURL(url)
 }
 
 func getRegistrationByNameURL(url string) *export.Registration {
 
-	response, err := http.Get(url)
+	response, err := clientGet(http.DefaultClient, url)
 	if err != nil {
 		logger.Error("Error getting all registrations", zap.String("url", url))
 		return nil
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		logger.Error("Error getting registration", zap.String("url", url),
+			zap.String("status", response.Status))
+		return nil
+	}
+
 	reg := export.Registration{}
 	if err := json.NewDecoder(response.Body).Decode(&reg); err != nil {
 		logger.Error("Could not parse json", zap.Error(err))
 		return nil
 	}
 
-	if !reg.Validate() {
-		logger.Error("Failed to validate registrations fields")
+	if err := reg.ValidateWith(capabilities()); err != nil {
+		logger.Error("Failed to validate registrations fields", zap.Error(err))
 		return nil
 	}
 	return &reg
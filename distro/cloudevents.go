@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	cloudEventsVersion  = "1.0"
+	mimeTypeCloudEvents = "application/cloudevents+json"
+	mimeTypeXML         = "application/xml"
+	mimeTypeOctetStream = "application/octet-stream"
+	// Source of the events if the registration and the host have no name
+	defaultCloudEventsSource = "edgex-export"
+)
+
+// Content types of the formats not setting their own
+var formatContentTypes = map[string]string{
+	export.FormatJSON: mimeTypeJSON,
+	export.FormatXML:  mimeTypeXML,
+}
+
+// cloudEvent - CloudEvents 1.0 envelope in structured mode. Data is the
+// payload if it is JSON or text, DataBase64 if it is binary
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Time            string      `json:"time,omitempty"`
+	Subject         string      `json:"subject,omitempty"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+	DataBase64      []byte      `json:"data_base64,omitempty"`
+}
+
+// cloudEventsFormater - wrap the payloads of a format in a CloudEvents
+// envelope. The id is the event ID, the source the gateway and device, the
+// type the registration name and the time the event origin
+type cloudEventsFormater struct {
+	format      Formater
+	binary      bool
+	source      string
+	eventType   string
+	contentType string
+}
+
+func newCloudEventsFormater(format Formater, reg export.Registration) Formater {
+	source := reg.CloudEvents.Source
+	if source == "" {
+		if host, err := os.Hostname(); err == nil && host != "" {
+			source = host
+		} else {
+			source = defaultCloudEventsSource
+		}
+	}
+
+	contentType, ok := formatContentTypes[reg.Format]
+	if !ok {
+		contentType = mimeTypeOctetStream
+	}
+	return cloudEventsFormater{
+		format:      format,
+		binary:      reg.CloudEvents.Mode == export.CloudEventsBinary,
+		source:      source,
+		eventType:   reg.Name,
+		contentType: contentType,
+	}
+}
+
+func (f cloudEventsFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Error("Error generating CloudEvent", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - envelope of the payload of the format. Payloads dropped
+// by the format are not wrapped
+func (f cloudEventsFormater) FormatMessage(event *export.Event) (Message, error) {
+	var msg Message
+	if mf, ok := f.format.(MessageFormater); ok {
+		var err error
+		if msg, err = mf.FormatMessage(event); err != nil {
+			return msg, err
+		}
+	} else {
+		msg.Data = f.format.Format(event)
+	}
+	if msg.Data == nil {
+		return msg, nil
+	}
+
+	contentType := f.contentType
+	headers := make(map[string]string)
+	for k, v := range msg.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+		} else {
+			headers[k] = v
+		}
+	}
+
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsVersion,
+		ID:              event.ID,
+		Source:          f.source + "/" + event.Device,
+		Type:            f.eventType,
+		Subject:         event.Device,
+		DataContentType: contentType,
+	}
+	if ce.ID == "" {
+		// The id is required, events not stored yet have none
+		ce.ID = bson.NewObjectId().Hex()
+	}
+	if event.Origin != 0 {
+		ce.Time = time.Unix(0, event.Origin*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+	}
+
+	if f.binary {
+		headers["ce-specversion"] = ce.SpecVersion
+		headers["ce-id"] = ce.ID
+		headers["ce-source"] = ce.Source
+		headers["ce-type"] = ce.Type
+		headers["ce-subject"] = ce.Subject
+		if ce.Time != "" {
+			headers["ce-time"] = ce.Time
+		}
+		headers["Content-Type"] = contentType
+		msg.Headers = headers
+		return msg, nil
+	}
+
+	switch {
+	case strings.Contains(contentType, "json") && json.Valid(msg.Data):
+		ce.Data = json.RawMessage(msg.Data)
+	case utf8.Valid(msg.Data):
+		ce.Data = string(msg.Data)
+	default:
+		ce.DataBase64 = msg.Data
+	}
+	data, err := json.Marshal(ce)
+	if err != nil {
+		return msg, err
+	}
+	headers["Content-Type"] = mimeTypeCloudEvents
+	msg.Data, msg.Headers = data, headers
+	return msg, nil
+}
@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+func cloudEventsRegistration(format, mode string) export.Registration {
+	return export.Registration{
+		Name:        "ce",
+		Format:      format,
+		Compression: export.CompNone,
+		Encryption:  export.EncryptionDetails{Algo: export.EncNone},
+		Destination: export.DestRest,
+		Addressable: export.Addressable{Address: "http://127.0.0.1", Port: 8080, Method: export.MethodPost},
+		Template:    &export.TemplateDetails{Source: "{{.Device}}", ContentType: "text/plain"},
+		CloudEvents: &export.CloudEventsDetails{Mode: mode, Source: "gw1"},
+	}
+}
+
+func cloudEventsEvent() *export.Event {
+	return &export.Event{
+		ID:       "ev1",
+		Device:   "dev1",
+		Origin:   1500000000123,
+		Readings: []export.Reading{{Name: "temperature", Value: "21.5"}},
+	}
+}
+
+func TestCloudEventsStructured(t *testing.T) {
+	logger = zap.NewNop()
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.updatePipeline(cloudEventsRegistration(export.FormatJSON, export.CloudEventsStructured)) {
+		t.Fatal("Registration should be valid")
+	}
+	res := regInfo.runPipeline(cloudEventsEvent())
+	if res.headers["Content-Type"] != mimeTypeCloudEvents {
+		t.Fatal("Unexpected headers", res.headers)
+	}
+
+	ce := struct {
+		cloudEvent
+		Data export.Event `json:"data"`
+	}{}
+	if err := json.Unmarshal(res.encrypted, &ce); err != nil {
+		t.Fatal(err)
+	}
+	if ce.SpecVersion != "1.0" || ce.ID != "ev1" || ce.Source != "gw1/dev1" || ce.Type != "ce" ||
+		ce.Time != "2017-07-14T02:40:00.123Z" || ce.DataContentType != mimeTypeJSON ||
+		ce.Data.Readings[0].Value != "21.5" {
+		t.Fatal("Unexpected CloudEvent", string(res.encrypted))
+	}
+
+	// Text payloads are strings, and events without ID get one
+	regInfo.updatePipeline(cloudEventsRegistration(export.FormatTemplate, export.CloudEventsStructured))
+	event := cloudEventsEvent()
+	event.ID = ""
+	res = regInfo.runPipeline(event)
+	m := map[string]interface{}{}
+	json.Unmarshal(res.encrypted, &m)
+	if m["data"] != "dev1" || m["datacontenttype"] != "text/plain" || m["id"] == "" {
+		t.Fatal("Unexpected CloudEvent", string(res.encrypted))
+	}
+}
+
+func TestCloudEventsBinary(t *testing.T) {
+	logger = zap.NewNop()
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.updatePipeline(cloudEventsRegistration(export.FormatTemplate, export.CloudEventsBinary)) {
+		t.Fatal("Registration should be valid")
+	}
+	res := regInfo.runPipeline(cloudEventsEvent())
+	expected := map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "ev1",
+		"ce-source":      "gw1/dev1",
+		"ce-type":        "ce",
+		"ce-subject":     "dev1",
+		"ce-time":        "2017-07-14T02:40:00.123Z",
+		"Content-Type":   "text/plain",
+	}
+	if string(res.encrypted) != "dev1" || len(res.headers) != len(expected) {
+		t.Fatal("Unexpected message", string(res.encrypted), res.headers)
+	}
+	for k, v := range expected {
+		if res.headers[k] != v {
+			t.Fatal("Unexpected header", k, res.headers[k])
+		}
+	}
+}
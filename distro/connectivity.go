@@ -0,0 +1,264 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"go.uber.org/zap"
+)
+
+// Time allowed to each step of a connectivity test
+const connectivityTimeout = 10 * time.Second
+
+// Payload published or posted by connectivity tests
+var testPayload = []byte(`{"test":true}`)
+
+var errTestTimeout = errors.New("timed out")
+
+// ConnectivityRequest - registration to test, either stored (by Name) or
+// inline. Probe is the method of the HTTP probe request: OPTIONS (the
+// default), HEAD or POST
+type ConnectivityRequest struct {
+	Name         string               `json:"name,omitempty"`
+	Registration *export.Registration `json:"registration,omitempty"`
+	Probe        string               `json:"probe,omitempty"`
+}
+
+// connackError - connection refused by an MQTT broker
+type connackError struct {
+	code byte
+	err  error
+}
+
+func (e connackError) Error() string {
+	return e.err.Error()
+}
+
+// statusError - unexpected status of an HTTP probe
+type statusError int
+
+func (e statusError) Error() string {
+	return "unexpected status " + strconv.Itoa(int(e)) + " " + http.StatusText(int(e))
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runStep - run fn as a step of res. It returns false, with the cause and
+// error of res set, if the step fails
+func runStep(res *export.ConnectivityResult, name string, fn func() (string, error)) bool {
+	start := time.Now()
+	detail, err := fn()
+	step := export.ConnectivityStep{
+		Name:    name,
+		Success: err == nil,
+		Latency: millis(time.Since(start)),
+		Detail:  detail,
+	}
+	res.Steps = append(res.Steps, step)
+	res.Latency += step.Latency
+
+	if err != nil {
+		res.Cause = errorCause(err)
+		res.Error = err.Error()
+		return false
+	}
+	return true
+}
+
+// dialStep - open and close a TCP connection with hostport
+func dialStep(res *export.ConnectivityResult, hostport string) bool {
+	return runStep(res, "dial", func() (string, error) {
+		conn, err := net.DialTimeout("tcp", hostport, connectivityTimeout)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.RemoteAddr().String(), nil
+	})
+}
+
+// errorCause - classify the error of a failed step
+func errorCause(err error) string {
+	if err == errTestTimeout {
+		return export.CauseTimeout
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return export.CauseTimeout
+	}
+
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+			continue
+		case *net.OpError:
+			err = e.Err
+			continue
+		case *os.SyscallError:
+			err = e.Err
+			continue
+		case *tls.CertificateVerificationError:
+			err = e.Err
+			continue
+		}
+		break
+	}
+
+	switch e := err.(type) {
+	case *net.DNSError:
+		return export.CauseDNS
+	case syscall.Errno:
+		if e == syscall.ECONNREFUSED {
+			return export.CauseRefused
+		}
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError,
+		tls.RecordHeaderError, tls.AlertError:
+		return export.CauseTLS
+	case connackError:
+		if e.code == packets.ErrRefusedBadUsernameOrPassword || e.code == packets.ErrRefusedNotAuthorised {
+			return export.CauseAuth
+		}
+		return export.CauseRejected
+	case statusError:
+		if e == http.StatusUnauthorized || e == http.StatusForbidden {
+			return export.CauseAuth
+		}
+		return export.CauseRejected
+	}
+	if strings.HasPrefix(err.Error(), "tls: ") {
+		return export.CauseTLS
+	}
+	return export.CauseNetwork
+}
+
+// tlsDetails - negotiated TLS version and cipher suite, and the
+// certificates presented by the peer
+func tlsDetails(state *tls.ConnectionState) *export.TLSDetails {
+	if state == nil {
+		return nil
+	}
+
+	details := &export.TLSDetails{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+	}
+	for _, cert := range state.PeerCertificates {
+		details.Certificates = append(details.Certificates, export.CertificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore.UnixNano() / int64(time.Millisecond),
+			NotAfter:  cert.NotAfter.UnixNano() / int64(time.Millisecond),
+		})
+	}
+	return details
+}
+
+// testConnectivity - open a connection with the destination of reg, with
+// the sender it would use
+func testConnectivity(reg export.Registration, probe string) export.ConnectivityResult {
+	res := export.ConnectivityResult{
+		Registration: reg.Name,
+		Destination:  reg.Destination,
+		Steps:        []export.ConnectivityStep{},
+	}
+
+	sender, err := newSender(reg)
+	if err != nil {
+		res.Cause = export.CauseUnsupported
+		res.Error = err.Error()
+		return res
+	}
+	var tester Tester
+	switch s := sender.(type) {
+	case httpSender:
+		s.probe = probe
+		tester = s
+	case Tester:
+		tester = s
+	default:
+		res.Cause = export.CauseUnsupported
+		res.Error = "destination can not be tested: " + reg.Destination
+		return res
+	}
+
+	tester.Test(&res)
+	res.Success = res.Cause == ""
+	return res
+}
+
+// testConnection - test the connection with the destination of a
+// registration. The reply is OK with the result of the test, failed or not
+func testConnection(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed read body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	req := ConnectivityRequest{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		logger.Error("Failed to parse", zap.ByteString("json", data))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	switch req.Probe {
+	case "", http.MethodOptions, http.MethodHead, http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Invalid probe: "+req.Probe)
+		return
+	}
+
+	if req.Registration != nil && !inlineAllowed(w, r) {
+		return
+	}
+
+	reg, ok := requestedRegistration(w, req.Name, req.Registration)
+	if !ok {
+		return
+	}
+
+	result := testConnectivity(*reg, req.Probe)
+	logger.Info("Connectivity test", zap.String("registration", result.Registration),
+		zap.Bool("success", result.Success), zap.String("cause", result.Cause))
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
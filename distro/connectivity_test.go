@@ -0,0 +1,237 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"go.uber.org/zap"
+)
+
+// mqttBroker - broker accepting a single connection, replying to CONNECT
+// with code and recording the topics published with QoS 1
+func mqttBroker(t *testing.T, code byte) (net.Listener, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := make(chan string, 1)
+
+	go func() {
+		// The dial step opens a connection of its own
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			p, err := packets.ReadPacket(conn)
+			if err != nil {
+				return
+			}
+			switch p := p.(type) {
+			case *packets.ConnectPacket:
+				ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+				ack.ReturnCode = code
+				ack.Write(conn)
+				if code != packets.Accepted {
+					return
+				}
+			case *packets.PublishPacket:
+				topics <- p.TopicName
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				ack.Write(conn)
+			case *packets.DisconnectPacket:
+				return
+			}
+		}
+	}()
+	return l, topics
+}
+
+func mqttRegistration(l net.Listener) export.Registration {
+	addr := l.Addr().(*net.TCPAddr)
+	return export.Registration{
+		Name:        "mqtt",
+		Destination: export.DestMQTT,
+		Addressable: export.Addressable{
+			Address:   "127.0.0.1",
+			Port:      addr.Port,
+			Publisher: "pub",
+			Topic:     "topic",
+		},
+	}
+}
+
+func restRegistration(t *testing.T, rawurl string) export.Registration {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return export.Registration{
+		Name:        "rest",
+		Format:      export.FormatJSON,
+		Destination: export.DestRest,
+		Addressable: export.Addressable{
+			Address: u.Scheme + "://" + u.Hostname(),
+			Port:    port,
+			Path:    "/events",
+			Method:  export.MethodPost,
+		},
+	}
+}
+
+func TestConnectivityMQTT(t *testing.T) {
+	logger = zap.NewNop()
+
+	l, topics := mqttBroker(t, packets.Accepted)
+	defer l.Close()
+	res := testConnectivity(mqttRegistration(l), "")
+	if !res.Success || len(res.Steps) != 3 || res.Steps[2].Name != "publish" || res.Cause != "" {
+		t.Fatal("Unexpected result", res)
+	}
+	if topic := <-topics; topic != "topic"+testTopicSuffix {
+		t.Fatal("Unexpected test topic", topic)
+	}
+
+	l, _ = mqttBroker(t, packets.ErrRefusedBadUsernameOrPassword)
+	defer l.Close()
+	res = testConnectivity(mqttRegistration(l), "")
+	if res.Success || res.Cause != export.CauseAuth || len(res.Steps) != 2 || res.Steps[1].Success {
+		t.Fatal("Bad credentials should fail with auth", res)
+	}
+}
+
+func TestConnectivityRefused(t *testing.T) {
+	logger = zap.NewNop()
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	reg := mqttRegistration(l)
+	l.Close()
+
+	res := testConnectivity(reg, "")
+	if res.Success || res.Cause != export.CauseRefused || len(res.Steps) != 1 {
+		t.Fatal("Closed port should be refused", res)
+	}
+
+	reg.Destination = export.DestAzureMQTT
+	res = testConnectivity(reg, "")
+	if res.Success || res.Cause != export.CauseUnsupported || len(res.Steps) != 0 {
+		t.Fatal("Destination should not be supported", res)
+	}
+}
+
+func TestConnectivityHTTP(t *testing.T) {
+	logger = zap.NewNop()
+
+	status := http.StatusOK
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	reg := restRegistration(t, ts.URL)
+
+	cases := []struct {
+		probe   string
+		status  int
+		success bool
+		cause   string
+	}{
+		{"", http.StatusOK, true, ""},
+		{http.MethodHead, http.StatusOK, true, ""},
+		{http.MethodOptions, http.StatusMethodNotAllowed, true, ""},
+		{http.MethodPost, http.StatusMethodNotAllowed, false, export.CauseRejected},
+		{http.MethodPost, http.StatusNotFound, false, export.CauseRejected},
+		{http.MethodPost, http.StatusUnauthorized, false, export.CauseAuth},
+	}
+	for i, c := range cases {
+		status = c.status
+		res := testConnectivity(reg, c.probe)
+		if res.Success != c.success || res.Cause != c.cause || len(res.Steps) != 2 {
+			t.Fatal("Unexpected result", i, res)
+		}
+		if c.probe == "" && method != http.MethodOptions || c.probe != "" && method != c.probe {
+			t.Fatal("Unexpected probe method", i, method)
+		}
+	}
+
+	tls := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tls.Close()
+	res := testConnectivity(restRegistration(t, tls.URL), "")
+	if res.Success || res.Cause != export.CauseTLS {
+		t.Fatal("Untrusted certificate should fail with tls", res)
+	}
+}
+
+func TestConnectivityHandler(t *testing.T) {
+	logger = zap.NewNop()
+	cfg.ClientAPIKey = "distro-key"
+	defer func() { cfg.ClientAPIKey = "" }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	reg := restRegistration(t, ts.URL)
+
+	post := func(req ConnectivityRequest) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(req)
+		r := httptest.NewRequest("POST", "/api/v1/test", bytes.NewReader(data))
+		r.Header.Set(apiKeyHeader, cfg.ClientAPIKey)
+		w := httptest.NewRecorder()
+		httpServer().ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(ConnectivityRequest{Registration: &reg})
+	res := export.ConnectivityResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !res.Success || res.Registration != "rest" ||
+		res.Target != ts.URL+"/events" {
+		t.Fatal("Unexpected reply", w.Code, res)
+	}
+
+	if w = post(ConnectivityRequest{Registration: &reg, Probe: "GET"}); w.Code != http.StatusBadRequest {
+		t.Fatal("Invalid probe should be rejected", w.Code)
+	}
+	if w = post(ConnectivityRequest{}); w.Code != http.StatusBadRequest {
+		t.Fatal("Missing registration should be rejected", w.Code)
+	}
+
+	// Inline registrations need the API key
+	cfg.ClientAPIKey = ""
+	if w = post(ConnectivityRequest{Registration: &reg}); w.Code != http.StatusUnauthorized {
+		t.Fatal("Inline registration without API key should be rejected", w.Code)
+	}
+	data, _ := json.Marshal(ConnectivityRequest{Registration: &reg})
+	cfg.ClientAPIKey = "distro-key"
+	r := httptest.NewRequest("POST", "/api/v1/test", bytes.NewReader(data))
+	r.Header.Set(apiKeyHeader, "wrong")
+	w = httptest.NewRecorder()
+	httpServer().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatal("Inline registration with a wrong API key should be rejected", w.Code)
+	}
+}
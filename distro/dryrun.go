@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/drasko/edgex-export"
+	"github.com/drasko/edgex-export/files"
+	"go.uber.org/zap"
+)
+
+// DryRunRequest - event to run through a registration, either stored
+// (by Name) or inline
+type DryRunRequest struct {
+	Name         string               `json:"name,omitempty"`
+	Registration *export.Registration `json:"registration,omitempty"`
+	Event        export.Event         `json:"event"`
+}
+
+// DryRunStage - output of a pipeline stage. Text is set for UTF-8 output
+// and Data, base64 encoded, for binary output
+type DryRunStage struct {
+	Size int    `json:"size"`
+	Text string `json:"text,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// DryRunResult - output of every stage of the registration for the event.
+// Accepted is false if the filters drop the event. Topic and Headers are
+// set by script formats, and Error if the format failed
+type DryRunResult struct {
+	Registration  string            `json:"registration"`
+	Accepted      bool              `json:"accepted"`
+	FilteredEvent *export.Event     `json:"filteredEvent,omitempty"`
+	Formatted     *DryRunStage      `json:"formatted,omitempty"`
+	Compressed    *DryRunStage      `json:"compressed,omitempty"`
+	Payload       *DryRunStage      `json:"payload,omitempty"`
+	Topic         string            `json:"topic,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Error         string            `json:"error,omitempty"`
+}
+
+func newDryRunStage(data []byte) *DryRunStage {
+	if data == nil {
+		return nil
+	}
+	stage := &DryRunStage{Size: len(data)}
+	if utf8.Valid(data) {
+		stage.Text = string(data)
+	} else {
+		stage.Data = data
+	}
+	return stage
+}
+
+// storedRegistration - registration by name from the client or, in
+// standalone mode, from the registration files
+func storedRegistration(name string) *export.Registration {
+	if cfg.RegistrationDir == "" {
+		return getRegistrationByName(name)
+	}
+
+	regs, err := files.Load(cfg.RegistrationDir, capabilities())
+	if err != nil {
+		logger.Error("Failed to load registration files", zap.Error(err))
+		return nil
+	}
+	for i := range regs {
+		if regs[i].Name == name {
+			return &regs[i]
+		}
+	}
+	return nil
+}
+
+// inlineAllowed - whether the request may run an inline registration,
+// replying with an error if not. Inline registrations have to be sent with
+// the API key distro uses with the client in X-API-Key, without one set
+// only stored registrations can be run
+func inlineAllowed(w http.ResponseWriter, r *http.Request) bool {
+	key := r.Header.Get(apiKeyHeader)
+	if cfg.ClientAPIKey != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(cfg.ClientAPIKey)) == 1 {
+		return true
+	}
+
+	logger.Warn("Unauthorized inline registration", zap.String("url", r.URL.String()),
+		zap.String("remote", r.RemoteAddr))
+	w.WriteHeader(http.StatusUnauthorized)
+	io.WriteString(w, "Inline registrations require the "+apiKeyHeader+" of distro")
+	return false
+}
+
+// requestedRegistration - registration to run a request with, the inline
+// one after validating it or the stored one by name. It replies with an
+// error if neither or both are set
+func requestedRegistration(w http.ResponseWriter, name string, reg *export.Registration) (*export.Registration, bool) {
+	switch {
+	case reg != nil && name != "":
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Set either name or registration")
+		return nil, false
+	case reg != nil:
+		if err := reg.ValidateWith(capabilities()); err != nil {
+			logger.Error("Failed to validate registrations fields", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, err.Error())
+			return nil, false
+		}
+	case name != "":
+		if reg = storedRegistration(name); reg == nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "Registration not found: "+name)
+			return nil, false
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Missing name or registration")
+		return nil, false
+	}
+	return reg, true
+}
+
+// dryRun - run the event through the filters, format, compression and
+// encryption of the registration, replying with the output of each stage.
+// The payload is not sent
+func dryRun(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed read body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	req := DryRunRequest{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		logger.Error("Failed to parse", zap.ByteString("json", data))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	if req.Registration != nil && !inlineAllowed(w, r) {
+		return
+	}
+
+	reg, ok := requestedRegistration(w, req.Name, req.Registration)
+	if !ok {
+		return
+	}
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.updatePipeline(*reg) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Registration not supported: "+reg.Name+": "+regInfo.err.Error())
+		return
+	}
+
+	out := regInfo.runPipeline(&req.Event)
+	// Batch formats hold the event, which is shown in a batch of its own
+	if flushed, ok := regInfo.flushPipeline(); ok {
+		flushed.filtered = out.filtered
+		out = flushed
+	}
+	result := DryRunResult{
+		Registration:  reg.Name,
+		Accepted:      out.filtered != nil,
+		FilteredEvent: out.filtered,
+		Formatted:     newDryRunStage(out.formatted),
+		Compressed:    newDryRunStage(out.compressed),
+		Payload:       newDryRunStage(out.encrypted),
+		Topic:         out.topic,
+		Headers:       out.headers,
+	}
+	if out.err != nil {
+		result.Error = out.err.Error()
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
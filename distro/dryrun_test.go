@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+func doDryRun(t *testing.T, req interface{}) (int, DryRunResult) {
+	data, _ := json.Marshal(req)
+	r := httptest.NewRequest("POST", "/api/v1/dryrun", bytes.NewReader(data))
+	r.Header.Set(apiKeyHeader, "distro-key")
+	w := httptest.NewRecorder()
+	httpServer().ServeHTTP(w, r)
+
+	result := DryRunResult{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, result
+}
+
+func TestDryRun(t *testing.T) {
+	logger = zap.NewNop()
+	cfg.ClientAPIKey = "distro-key"
+	defer func() { cfg.ClientAPIKey = "" }()
+
+	reg := export.Registration{
+		Name:        "dry",
+		Format:      export.FormatJSON,
+		Destination: export.DestMQTT,
+		Addressable: export.Addressable{Address: "127.0.0.1", Port: 1883, Topic: "topic"},
+		Filter:      export.Filter{DeviceIDs: []string{"dev1"}},
+	}
+	event := export.Event{Device: "dev1", Readings: []export.Reading{{Name: "temp", Value: "20"}}}
+
+	code, res := doDryRun(t, DryRunRequest{Registration: &reg, Event: event})
+	if code != http.StatusOK || !res.Accepted || res.FilteredEvent.Device != "dev1" ||
+		res.Formatted.Text == "" || res.Payload.Text != res.Formatted.Text {
+		t.Fatal("Unexpected dry run", code, res)
+	}
+
+	reg.Compression = export.CompGzip
+	code, res = doDryRun(t, DryRunRequest{Registration: &reg, Event: event})
+	if code != http.StatusOK || res.Compressed.Text == res.Formatted.Text ||
+		res.Compressed.Size != len(res.Compressed.Text) || res.Payload.Size != res.Compressed.Size {
+		t.Fatal("Unexpected compressed dry run", code, res)
+	}
+
+	// Batch formats show the event in a batch of its own
+	batch := reg
+	batch.Format = export.FormatAvroOCF
+	batch.Compression = export.CompNone
+	batch.Avro = &export.AvroDetails{BatchSize: 10}
+	code, res = doDryRun(t, DryRunRequest{Registration: &batch, Event: event})
+	if code != http.StatusOK || !res.Accepted || res.Payload == nil ||
+		!bytes.HasPrefix(res.Payload.Data, avroContainerMagic) {
+		t.Fatal("Unexpected batch dry run", code, res)
+	}
+
+	event.Device = "dev2"
+	code, res = doDryRun(t, DryRunRequest{Registration: &reg, Event: event})
+	if code != http.StatusOK || res.Accepted || res.Formatted != nil {
+		t.Fatal("Event should be filtered out", code, res)
+	}
+
+	// Stored registration, read from the files in standalone mode
+	dir, err := ioutil.TempDir("", "dryrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, _ := json.Marshal(reg)
+	ioutil.WriteFile(filepath.Join(dir, "dry.json"), data, 0600)
+	cfg.RegistrationDir = dir
+	defer func() { cfg.RegistrationDir = "" }()
+
+	event.Device = "dev1"
+	code, res = doDryRun(t, DryRunRequest{Name: "dry", Event: event})
+	if code != http.StatusOK || !res.Accepted || res.Registration != "dry" {
+		t.Fatal("Unexpected dry run", code, res)
+	}
+
+	invalid := reg
+	invalid.Format = "WRONG"
+	cases := []struct {
+		req  DryRunRequest
+		code int
+	}{
+		{DryRunRequest{Name: "unknown"}, http.StatusNotFound},
+		{DryRunRequest{}, http.StatusBadRequest},
+		{DryRunRequest{Name: "dry", Registration: &reg}, http.StatusBadRequest},
+		{DryRunRequest{Registration: &invalid}, http.StatusBadRequest},
+	}
+	for i, c := range cases {
+		if code, _ := doDryRun(t, c.req); code != c.code {
+			t.Errorf("case %d: expected status %d got %d", i+1, c.code, code)
+		}
+	}
+
+	// Inline registrations need the API key, stored ones do not
+	data, _ = json.Marshal(DryRunRequest{Registration: &reg, Event: event})
+	for _, c := range []struct{ configured, sent string }{
+		{"distro-key", ""}, {"distro-key", "wrong"}, {"", ""},
+	} {
+		cfg.ClientAPIKey = c.configured
+		r := httptest.NewRequest("POST", "/api/v1/dryrun", bytes.NewReader(data))
+		r.Header.Set(apiKeyHeader, c.sent)
+		w := httptest.NewRecorder()
+		httpServer().ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatal("Inline registration should be rejected", c, w.Code)
+		}
+	}
+	if code, _ = doDryRun(t, DryRunRequest{Name: "dry", Event: event}); code != http.StatusOK {
+		t.Fatal("Stored registration should not need the API key", code)
+	}
+}
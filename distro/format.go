@@ -7,19 +7,41 @@
 package distro
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"strconv"
 
 	"github.com/drasko/edgex-export"
+	"github.com/ugorji/go/codec"
 	"go.uber.org/zap"
 )
 
+const (
+	mimeTypeMsgPack = "application/msgpack"
+	mimeTypeCBOR    = "application/cbor"
+)
+
+// jsonFormater - JSON format of the events, with the fields of mapping if
+// set
 type jsonFormater struct {
+	mapping *jsonMapping
+}
+
+func newJSONFormater(reg export.Registration) (Formater, error) {
+	if reg.Mapping == nil {
+		return jsonFormater{}, nil
+	}
+	return jsonFormater{mapping: newJSONMapping(reg.Mapping)}, nil
 }
 
 func (jsonTr jsonFormater) Format(event *export.Event) []byte {
+	var v interface{} = event
+	if jsonTr.mapping != nil {
+		v = jsonTr.mapping.mapEvent(event)
+	}
 
-	b, err := json.Marshal(event)
+	b, err := json.Marshal(v)
 	if err != nil {
 		logger.Error("Error parsing JSON", zap.Error(err))
 		return nil
@@ -27,14 +49,147 @@ func (jsonTr jsonFormater) Format(event *export.Event) []byte {
 	return b
 }
 
+// xmlFormater - XML documents of the events, with the structure published
+// by export.XMLSchema
 type xmlFormater struct {
+	options export.XMLDetails
+}
+
+func newXMLFormater(reg export.Registration) (Formater, error) {
+	return xmlFormater{options: reg.XMLOptions()}, nil
+}
+
+// name - element name, qualified with the prefix if set
+func (xmlTr xmlFormater) name(local string) xml.Name {
+	if xmlTr.options.Prefix != "" {
+		local = xmlTr.options.Prefix + ":" + local
+	}
+	return xml.Name{Local: local}
+}
+
+func xmlAttr(name, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+// xmlReadingFields - fields of a reading, the strings left out when empty
+// as in the JSON format
+func xmlReadingFields(r *export.Reading) []xml.Attr {
+	var fields []xml.Attr
+	for _, f := range []xml.Attr{xmlAttr("id", r.ID), xmlAttr("name", r.Name), xmlAttr("value", r.Value),
+		xmlAttr("device", r.Device)} {
+		if f.Value != "" {
+			fields = append(fields, f)
+		}
+	}
+	return append(fields,
+		xmlAttr("pushed", strconv.FormatInt(r.Pushed, 10)),
+		xmlAttr("created", strconv.FormatInt(r.Created, 10)),
+		xmlAttr("modified", strconv.FormatInt(r.Modified, 10)),
+		xmlAttr("origin", strconv.FormatInt(r.Origin, 10)))
+}
+
+func (xmlTr xmlFormater) encode(enc *xml.Encoder, event *export.Event) error {
+	ns := "xmlns"
+	if xmlTr.options.Prefix != "" {
+		ns += ":" + xmlTr.options.Prefix
+	}
+	root := xml.StartElement{Name: xmlTr.name(xmlTr.options.Root), Attr: []xml.Attr{xmlAttr(ns, xmlTr.options.Namespace)}}
+	if event.ID != "" {
+		root.Attr = append(root.Attr, xmlAttr("id", event.ID))
+	}
+	if event.Device != "" {
+		root.Attr = append(root.Attr, xmlAttr("device", event.Device))
+	}
+	root.Attr = append(root.Attr,
+		xmlAttr("pushed", strconv.FormatInt(event.Pushed, 10)),
+		xmlAttr("created", strconv.FormatInt(event.Created, 10)),
+		xmlAttr("modified", strconv.FormatInt(event.Modified, 10)),
+		xmlAttr("origin", strconv.FormatInt(event.Origin, 10)))
+	if err := enc.EncodeToken(root); err != nil {
+		return err
+	}
+
+	for i := range event.Readings {
+		fields := xmlReadingFields(&event.Readings[i])
+		reading := xml.StartElement{Name: xmlTr.name(export.XMLReadingElement)}
+		if xmlTr.options.Readings == export.XMLReadingsAttributes {
+			reading.Attr = fields
+			if err := enc.EncodeToken(reading); err != nil {
+				return err
+			}
+		} else {
+			if err := enc.EncodeToken(reading); err != nil {
+				return err
+			}
+			for _, f := range fields {
+				field := xml.StartElement{Name: xmlTr.name(f.Name.Local)}
+				if err := enc.EncodeElement(f.Value, field); err != nil {
+					return err
+				}
+			}
+		}
+		if err := enc.EncodeToken(reading.End()); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	return enc.Flush()
 }
 
 func (xmlTr xmlFormater) Format(event *export.Event) []byte {
-	b, err := xml.Marshal(event)
+	msg, err := xmlTr.FormatMessage(event)
 	if err != nil {
-		logger.Error("Error parsing XML", zap.Error(err))
+		logger.Error("Error generating XML", zap.Error(err))
 		return nil
 	}
-	return b
+	return msg.Data
+}
+
+// FormatMessage - XML document of the event, with its declaration
+func (xmlTr xmlFormater) FormatMessage(event *export.Event) (Message, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xmlTr.encode(xml.NewEncoder(&buf), event); err != nil {
+		return Message{}, err
+	}
+	return Message{Data: buf.Bytes(), Headers: map[string]string{"Content-Type": mimeTypeXML}}, nil
+}
+
+// codecFormater - binary encoding of the event, with the field names of the
+// JSON format
+type codecFormater struct {
+	handle      codec.Handle
+	contentType string
+}
+
+func newMsgPackFormater() codecFormater {
+	h := &codec.MsgpackHandle{}
+	// Use the str 8 and bin types of the current spec
+	h.WriteExt = true
+	return codecFormater{handle: h, contentType: mimeTypeMsgPack}
+}
+
+func newCBORFormater() codecFormater {
+	return codecFormater{handle: &codec.CborHandle{}, contentType: mimeTypeCBOR}
+}
+
+func (f codecFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Error("Error encoding event", zap.String("contentType", f.contentType), zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - encoded event, with its content type
+func (f codecFormater) FormatMessage(event *export.Event) (Message, error) {
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, f.handle).Encode(event); err != nil {
+		return Message{}, err
+	}
+	return Message{Data: b, Headers: map[string]string{"Content-Type": f.contentType}}, nil
 }
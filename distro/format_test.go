@@ -0,0 +1,98 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+func formatEvent() *export.Event {
+	return &export.Event{
+		ID:       "ev1",
+		Pushed:   1500000000100,
+		Device:   "dev1",
+		Created:  1500000000200,
+		Modified: 1500000000300,
+		Origin:   1500000000400,
+		Readings: []export.Reading{
+			{ID: "r1", Name: "temperature", Value: "21.5", Device: "dev1", Origin: 1500000000400},
+			{Name: "state", Value: "idle"},
+		},
+	}
+}
+
+// The binary encodings have the fields of the JSON format, and decode to
+// the same event
+func TestCodecFormatRoundTrip(t *testing.T) {
+	logger = zap.NewNop()
+
+	event := formatEvent()
+	jsonData := jsonFormater{}.Format(event)
+	fromJSON := export.Event{}
+	if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	jsonDoc := map[string]interface{}{}
+	json.Unmarshal(jsonData, &jsonDoc)
+
+	msgpack := &codec.MsgpackHandle{}
+	msgpack.RawToString = true
+
+	cases := []struct {
+		format      string
+		handle      codec.Handle
+		contentType string
+	}{
+		{export.FormatMsgPack, msgpack, mimeTypeMsgPack},
+		{export.FormatCBOR, &codec.CborHandle{}, mimeTypeCBOR},
+	}
+	for _, c := range cases {
+		f, err := newFormater(export.Registration{Format: c.format})
+		if err != nil {
+			t.Fatal(c.format, err)
+		}
+		msg, err := f.(MessageFormater).FormatMessage(event)
+		if err != nil {
+			t.Fatal(c.format, err)
+		}
+		if msg.Headers["Content-Type"] != c.contentType {
+			t.Fatal("Unexpected content type", c.format, msg.Headers)
+		}
+
+		decoded := export.Event{}
+		if err := codec.NewDecoderBytes(msg.Data, c.handle).Decode(&decoded); err != nil {
+			t.Fatal(c.format, err)
+		}
+		if !reflect.DeepEqual(decoded, fromJSON) || !reflect.DeepEqual(decoded, *event) {
+			t.Fatal("Event should round trip", c.format, decoded)
+		}
+
+		doc := map[string]interface{}{}
+		if err := codec.NewDecoderBytes(msg.Data, c.handle).Decode(&doc); err != nil {
+			t.Fatal(c.format, err)
+		}
+		if len(doc) != len(jsonDoc) {
+			t.Fatal("Unexpected fields", c.format, doc)
+		}
+		for field := range jsonDoc {
+			if _, ok := doc[field]; !ok {
+				t.Fatal("Missing field", c.format, field)
+			}
+		}
+		readings, _ := doc["readings"].([]interface{})
+		if len(readings) != 2 || len(readings[1].(map[interface{}]interface{})) !=
+			len(jsonDoc["readings"].([]interface{})[1].(map[string]interface{})) {
+			t.Fatal("Unexpected reading fields", c.format, readings)
+		}
+	}
+}
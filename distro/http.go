@@ -10,8 +10,12 @@ package distro
 
 import (
 	"bytes"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/drasko/edgex-export"
 	"go.uber.org/zap"
@@ -20,6 +24,10 @@ import (
 type httpSender struct {
 	url    string
 	method string
+	// Method of the connectivity test request, OPTIONS if empty
+	probe string
+	// Headers of every request, as the credentials of presets
+	headers map[string]string
 }
 
 const mimeTypeJSON = "application/json"
@@ -36,28 +44,112 @@ func NewHTTPSender(addr export.Addressable) Sender {
 }
 
 func (sender httpSender) Send(data []byte) {
-	switch sender.method {
+	sender.SendMessage(Message{Data: data})
+}
 
+// SendMessage - send the payload of msg with its headers. A Content-Type
+// header replaces the default one
+func (sender httpSender) SendMessage(msg Message) {
+	var body io.Reader
+	switch sender.method {
 	case export.MethodGet:
-		response, err := http.Get(sender.url)
-		if err != nil {
-			logger.Error("Error: ", zap.Error(err))
-			return
-		}
-		defer response.Body.Close()
-		logger.Info("Response: ", zap.String("status", response.Status))
-
 	case export.MethodPost:
-		response, err := http.Post(sender.url, mimeTypeJSON, bytes.NewReader(data))
-		if err != nil {
-			logger.Error("Error: ", zap.Error(err))
-			return
-		}
-		defer response.Body.Close()
-		logger.Info("Response: ", zap.String("status", response.Status))
+		body = bytes.NewReader(msg.Data)
 	default:
 		logger.Info("Unsupported method: ", zap.String("method", sender.method))
+		return
+	}
+
+	req, err := http.NewRequest(sender.method, sender.url, body)
+	if err != nil {
+		logger.Error("Error: ", zap.Error(err))
+		return
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", mimeTypeJSON)
+	}
+	for k, v := range sender.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range msg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error("Error: ", zap.Error(err))
+		return
+	}
+	defer response.Body.Close()
+	logger.Info("Response: ", zap.String("status", response.Status))
+
+	logger.Info("Sent data: ", zap.ByteString("data", msg.Data))
+}
+
+// probeStatus - error for the status of a probe request. Methods other than
+// POST may be rejected, the endpoint was still reached
+func probeStatus(method string, code int) error {
+	switch {
+	case code < http.StatusBadRequest:
+		return nil
+	case method != http.MethodPost &&
+		(code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented):
+		return nil
+	}
+	return statusError(code)
+}
+
+// Test - send the probe request to the endpoint. POST probes send
+// testPayload
+func (sender httpSender) Test(res *export.ConnectivityResult) {
+	res.Target = sender.url
+	u, err := url.Parse(sender.url)
+	if err != nil || u.Host == "" {
+		res.Cause = export.CauseUnsupported
+		res.Error = "invalid URL: " + sender.url
+		return
+	}
+
+	hostport := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		hostport = net.JoinHostPort(u.Hostname(), port)
+	}
+	if !dialStep(res, hostport) {
+		return
+	}
+
+	method := sender.probe
+	if method == "" {
+		method = http.MethodOptions
+	}
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader(testPayload)
 	}
 
-	logger.Info("Sent data: ", zap.ByteString("data", data))
+	client := http.Client{Timeout: connectivityTimeout}
+	runStep(res, strings.ToLower(method), func() (string, error) {
+		req, err := http.NewRequest(method, sender.url, body)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range sender.headers {
+			req.Header.Set(k, v)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", mimeTypeJSON)
+		}
+
+		response, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		response.Body.Close()
+		res.TLS = tlsDetails(response.TLS)
+		return response.Status, probeStatus(method, response.StatusCode)
+	})
 }
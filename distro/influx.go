@@ -0,0 +1,200 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drasko/edgex-export"
+)
+
+const (
+	mimeTypeInfluxLine = "text/plain; charset=utf-8"
+	// Path of the write endpoint of InfluxDB 2
+	influxWritePath = "/api/v2/write"
+	// Field of the measurements named as the reading
+	influxValueField = "value"
+)
+
+var (
+	// Escaping of measurements, and of tag keys, tag values and field keys
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxTag - tag of the lines, set from a field of the event or reading
+type influxTag struct {
+	key    string
+	source string
+}
+
+// influxFormater - InfluxDB line protocol format, with a line for each
+// reading
+type influxFormater struct {
+	byDevice  bool
+	tags      []influxTag
+	precision string
+}
+
+func newInfluxFormater(reg export.Registration) (Formater, error) {
+	f := influxFormater{precision: export.InfluxPrecisionMs}
+	if reg.Influx == nil {
+		return f, nil
+	}
+
+	switch reg.Influx.Measurement {
+	case "", export.InfluxMeasurementReading:
+	case export.InfluxMeasurementDevice:
+		f.byDevice = true
+	default:
+		return nil, errors.New("unknown measurement " + reg.Influx.Measurement)
+	}
+	if reg.Influx.Precision != "" {
+		if _, ok := influxScale(reg.Influx.Precision); !ok {
+			return nil, errors.New("unknown precision " + reg.Influx.Precision)
+		}
+		f.precision = reg.Influx.Precision
+	}
+
+	for key, source := range reg.Influx.Tags {
+		f.tags = append(f.tags, influxTag{key: key, source: source})
+	}
+	// InfluxDB writes tags sorted by key the fastest
+	sort.Slice(f.tags, func(i, j int) bool { return f.tags[i].key < f.tags[j].key })
+	return f, nil
+}
+
+// influxScale - multiplier (or divider, if negative) turning times in ms
+// into precision
+func influxScale(precision string) (int64, bool) {
+	switch precision {
+	case export.InfluxPrecisionNs:
+		return 1000000, true
+	case export.InfluxPrecisionUs:
+		return 1000, true
+	case export.InfluxPrecisionMs:
+		return 1, true
+	case export.InfluxPrecisionS:
+		return -1000, true
+	}
+	return 0, false
+}
+
+func influxTagValue(source string, event *export.Event, reading *export.Reading) string {
+	switch source {
+	case export.InfluxTagDevice:
+		return event.Device
+	case export.InfluxTagEventID:
+		return event.ID
+	case export.InfluxTagName:
+		return reading.Name
+	case export.InfluxTagReadingID:
+		return reading.ID
+	case export.InfluxTagReadingDevice:
+		return reading.Device
+	}
+	return ""
+}
+
+// influxFieldValue - field value of a reading value: a float, a boolean
+// ("true" or "false") or else a string. NaN and infinities, which InfluxDB
+// does not store as floats, are strings
+func influxFieldValue(value string) string {
+	if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	if value == "true" || value == "false" {
+		return value
+	}
+	return `"` + influxStringEscaper.Replace(value) + `"`
+}
+
+func (f influxFormater) Format(event *export.Event) []byte {
+	var buf bytes.Buffer
+	scale, _ := influxScale(f.precision)
+
+	for i := range event.Readings {
+		reading := &event.Readings[i]
+		measurement, field := reading.Name, influxValueField
+		if f.byDevice {
+			measurement, field = event.Device, reading.Name
+		}
+		if measurement == "" || field == "" {
+			continue
+		}
+
+		buf.WriteString(influxMeasurementEscaper.Replace(measurement))
+		for _, tag := range f.tags {
+			// Empty tag values are not allowed
+			if v := influxTagValue(tag.source, event, reading); v != "" {
+				buf.WriteString("," + influxKeyEscaper.Replace(tag.key) + "=" + influxKeyEscaper.Replace(v))
+			}
+		}
+		buf.WriteString(" " + influxKeyEscaper.Replace(field) + "=" + influxFieldValue(reading.Value))
+
+		origin := reading.Origin
+		if origin == 0 {
+			origin = event.Origin
+		}
+		if origin != 0 {
+			ts := origin * scale
+			if scale < 0 {
+				ts = origin / -scale
+			}
+			buf.WriteString(" " + strconv.FormatInt(ts, 10))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// FormatMessage - lines of the event, with the line protocol content type
+func (f influxFormater) FormatMessage(event *export.Event) (Message, error) {
+	return Message{
+		Data:    f.Format(event),
+		Headers: map[string]string{"Content-Type": mimeTypeInfluxLine},
+	}, nil
+}
+
+// newInfluxSender - REST sender posting to the write endpoint of InfluxDB 2
+// with the bucket, org and precision of reg, authenticated with the token in
+// Addressable.Password
+func newInfluxSender(reg export.Registration) (Sender, error) {
+	if reg.Influx == nil || reg.Influx.Bucket == "" || reg.Influx.Org == "" {
+		return nil, errors.New("bucket and org are required for " + export.DestInfluxDB)
+	}
+
+	addr := reg.Addressable
+	if addr.Path == "" {
+		addr.Path = influxWritePath
+	}
+	addr.Method = export.MethodPost
+	sender := NewHTTPSender(addr).(httpSender)
+
+	query := url.Values{}
+	query.Set("bucket", reg.Influx.Bucket)
+	query.Set("org", reg.Influx.Org)
+	precision := reg.Influx.Precision
+	if precision == "" {
+		precision = export.InfluxPrecisionMs
+	}
+	query.Set("precision", precision)
+	sender.url += "?" + query.Encode()
+
+	sender.headers = map[string]string{
+		"Authorization": "Token " + addr.Password,
+		"Content-Type":  mimeTypeInfluxLine,
+	}
+	return sender, nil
+}
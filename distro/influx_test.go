@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+func influxEvent() *export.Event {
+	return &export.Event{
+		ID:     "ev1",
+		Device: "dev 1",
+		Origin: 1500000000500,
+		Readings: []export.Reading{
+			{Name: "temperature", Value: "21.5"},
+			{Name: "open", Value: "true", Origin: 1500000001500},
+			{Name: "state", Value: `say "hi"`},
+		},
+	}
+}
+
+func TestInfluxFormat(t *testing.T) {
+	logger = zap.NewNop()
+
+	cases := []struct {
+		influx   *export.InfluxDetails
+		expected string
+	}{
+		{nil, "temperature value=21.5 1500000000500\n" +
+			"open value=true 1500000001500\n" +
+			"state value=\"say \\\"hi\\\"\" 1500000000500\n"},
+		{&export.InfluxDetails{
+			Measurement: export.InfluxMeasurementDevice,
+			Tags:        map[string]string{"id": export.InfluxTagEventID, "dev": export.InfluxTagDevice},
+			Precision:   export.InfluxPrecisionS,
+		}, "dev\\ 1,dev=dev\\ 1,id=ev1 temperature=21.5 1500000000\n" +
+			"dev\\ 1,dev=dev\\ 1,id=ev1 open=true 1500000001\n" +
+			"dev\\ 1,dev=dev\\ 1,id=ev1 state=\"say \\\"hi\\\"\" 1500000000\n"},
+		{&export.InfluxDetails{
+			Tags:      map[string]string{"reading": export.InfluxTagReadingID},
+			Precision: export.InfluxPrecisionNs,
+		}, "temperature value=21.5 1500000000500000000\n" +
+			"open value=true 1500000001500000000\n" +
+			"state value=\"say \\\"hi\\\"\" 1500000000500000000\n"},
+	}
+	for i, c := range cases {
+		f, err := newFormater(export.Registration{Format: export.FormatInfluxLine, Influx: c.influx})
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		msg, _ := f.(MessageFormater).FormatMessage(influxEvent())
+		if string(msg.Data) != c.expected || msg.Headers["Content-Type"] != mimeTypeInfluxLine {
+			t.Fatal("Unexpected lines", i, string(msg.Data))
+		}
+	}
+
+	values := map[string]string{
+		"21.50":    "21.5",
+		"1e3":      "1000",
+		"false":    "false",
+		"NaN":      `"NaN"`,
+		"Inf":      `"Inf"`,
+		"-Inf":     `"-Inf"`,
+		"infinity": `"infinity"`,
+		"on":       `"on"`,
+	}
+	for value, expected := range values {
+		if field := influxFieldValue(value); field != expected {
+			t.Fatal("Unexpected field value", value, field)
+		}
+	}
+
+	reg := export.Registration{Format: export.FormatInfluxLine, Influx: &export.InfluxDetails{Precision: "m"}}
+	if _, err := newFormater(reg); err == nil {
+		t.Fatal("Unknown precision should be rejected")
+	}
+}
+
+func TestInfluxSender(t *testing.T) {
+	logger = zap.NewNop()
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	reg := restRegistration(t, ts.URL)
+	reg.Format = export.FormatInfluxLine
+	reg.Destination = export.DestInfluxDB
+	reg.Addressable.Path = ""
+	reg.Addressable.Password = "secret"
+	reg.Influx = &export.InfluxDetails{Bucket: "gateway", Org: "acme", Precision: export.InfluxPrecisionUs}
+
+	if err := reg.ValidateWith(capabilities()); err != nil {
+		t.Fatal(err)
+	}
+	regInfo := newRegistrationInfo()
+	if !regInfo.update(reg) {
+		t.Fatal("Registration should be valid")
+	}
+	defer statusDeleted(reg.Name)
+	regInfo.processEvent(influxEvent())
+
+	r := <-received
+	q := r.URL.Query()
+	if r.Method != http.MethodPost || r.URL.Path != influxWritePath || q.Get("bucket") != "gateway" ||
+		q.Get("org") != "acme" || q.Get("precision") != "us" {
+		t.Fatal("Unexpected request", r.Method, r.URL)
+	}
+	if r.Header.Get("Authorization") != "Token secret" || r.Header.Get("Content-Type") != mimeTypeInfluxLine {
+		t.Fatal("Unexpected headers", r.Header)
+	}
+	if string(body) != "temperature value=21.5 1500000000500000\n"+
+		"open value=true 1500000001500000\n"+
+		"state value=\"say \\\"hi\\\"\" 1500000000500000\n" {
+		t.Fatal("Unexpected body", string(body))
+	}
+
+	reg.Influx.Org = ""
+	if _, err := newSender(reg); err == nil {
+		t.Fatal("Missing org should be rejected")
+	}
+}
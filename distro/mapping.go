@@ -0,0 +1,188 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drasko/edgex-export"
+)
+
+// Fields of the flattened events, other than the readings
+const (
+	flatID     = "id"
+	flatDevice = "device"
+	flatTime   = "ts"
+)
+
+// fieldRules - mapping rules of the fields of an object
+type fieldRules struct {
+	include map[string]bool
+	exclude map[string]bool
+	rename  map[string]string
+}
+
+// apply - obj with the rules applied, in place
+func (r fieldRules) apply(obj map[string]interface{}) map[string]interface{} {
+	if len(r.include) > 0 {
+		for k := range obj {
+			if !r.include[k] {
+				delete(obj, k)
+			}
+		}
+	}
+	for k := range r.exclude {
+		delete(obj, k)
+	}
+
+	// Fields are all moved at once, so they can be swapped
+	moved := make(map[string]interface{})
+	for from, to := range r.rename {
+		if v, ok := obj[from]; ok {
+			moved[to] = v
+			delete(obj, from)
+		}
+	}
+	for k, v := range moved {
+		obj[k] = v
+	}
+	return obj
+}
+
+// jsonMapping - rules of the event and reading fields of a mapping
+type jsonMapping struct {
+	flatten     bool
+	rfc3339     bool
+	typedValues bool
+	event       fieldRules
+	reading     fieldRules
+}
+
+func newJSONMapping(m *export.JSONMapping) *jsonMapping {
+	res := &jsonMapping{
+		flatten:     m.Flatten,
+		rfc3339:     m.TimeFormat == export.MappingTimeRFC3339,
+		typedValues: m.TypedValues,
+	}
+	res.event, res.reading = newFieldRules(), newFieldRules()
+
+	// Rules of the readings only apply to readings not flattened
+	rules := func(field string) (fieldRules, string, bool) {
+		if strings.HasPrefix(field, export.MappingReadings) {
+			return res.reading, strings.TrimPrefix(field, export.MappingReadings), !m.Flatten
+		}
+		return res.event, field, true
+	}
+	for _, field := range m.Include {
+		if r, name, ok := rules(field); ok {
+			r.include[name] = true
+		}
+	}
+	for _, field := range m.Exclude {
+		if r, name, ok := rules(field); ok {
+			r.exclude[name] = true
+		}
+	}
+	for from, to := range m.Rename {
+		if r, name, ok := rules(from); ok {
+			r.rename[name] = to
+		}
+	}
+	return res
+}
+
+func newFieldRules() fieldRules {
+	return fieldRules{
+		include: make(map[string]bool),
+		exclude: make(map[string]bool),
+		rename:  make(map[string]string),
+	}
+}
+
+// setTime - set a time in ms, as an RFC 3339 string in UTC if set in the
+// mapping. Unset times are left out of RFC 3339 objects
+func (m *jsonMapping) setTime(obj map[string]interface{}, field string, ms int64) {
+	if !m.rfc3339 {
+		obj[field] = ms
+	} else if ms != 0 {
+		obj[field] = time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// value - reading value, as a JSON number or boolean if typed values are
+// set and it parses as one
+func (m *jsonMapping) value(value string) interface{} {
+	if !m.typedValues {
+		return value
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		// Numbers are sent as they are written when valid JSON, so large
+		// integers keep their precision
+		if json.Valid([]byte(value)) {
+			return json.Number(value)
+		}
+		return v
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
+
+// setString - set a string, left out if empty as in export.Event
+func setString(obj map[string]interface{}, field, value string) {
+	if value != "" {
+		obj[field] = value
+	}
+}
+
+// mapEvent - event as an object with the fields of the mapping
+func (m *jsonMapping) mapEvent(event *export.Event) map[string]interface{} {
+	obj := make(map[string]interface{})
+	if m.flatten {
+		for _, r := range event.Readings {
+			if r.Name != "" {
+				obj[r.Name] = m.value(r.Value)
+			}
+		}
+		// Event fields take precedence over readings named as them
+		setString(obj, flatID, event.ID)
+		setString(obj, flatDevice, event.Device)
+		m.setTime(obj, flatTime, event.Origin)
+		return m.event.apply(obj)
+	}
+
+	setString(obj, "id", event.ID)
+	setString(obj, "device", event.Device)
+	m.setTime(obj, "pushed", event.Pushed)
+	m.setTime(obj, "created", event.Created)
+	m.setTime(obj, "modified", event.Modified)
+	m.setTime(obj, "origin", event.Origin)
+	if len(event.Readings) > 0 {
+		readings := make([]interface{}, 0, len(event.Readings))
+		for _, r := range event.Readings {
+			reading := make(map[string]interface{})
+			setString(reading, "id", r.ID)
+			setString(reading, "name", r.Name)
+			setString(reading, "device", r.Device)
+			if r.Value != "" {
+				reading["value"] = m.value(r.Value)
+			}
+			m.setTime(reading, "pushed", r.Pushed)
+			m.setTime(reading, "created", r.Created)
+			m.setTime(reading, "modified", r.Modified)
+			m.setTime(reading, "origin", r.Origin)
+			readings = append(readings, m.reading.apply(reading))
+		}
+		obj["readings"] = readings
+	}
+	return m.event.apply(obj)
+}
@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+func mapEvent(t *testing.T, mapping *export.JSONMapping, event *export.Event) map[string]interface{} {
+	reg := export.Registration{Format: export.FormatJSON, Mapping: mapping}
+	f, err := newFormater(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(f.Format(event), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestJSONMapping(t *testing.T) {
+	event := formatEvent()
+
+	// Without rules, events are sent as the JSON format does
+	doc := mapEvent(t, &export.JSONMapping{}, event)
+	plain := map[string]interface{}{}
+	json.Unmarshal(jsonFormater{}.Format(event), &plain)
+	if !reflect.DeepEqual(doc, plain) {
+		t.Fatal("Unexpected event", doc, plain)
+	}
+
+	doc = mapEvent(t, &export.JSONMapping{
+		Exclude:     []string{"pushed", "created", "modified", "readings.pushed", "readings.created", "readings.modified"},
+		Rename:      map[string]string{"origin": "ts", "readings.value": "v"},
+		TimeFormat:  export.MappingTimeRFC3339,
+		TypedValues: true,
+	}, event)
+	expected := map[string]interface{}{
+		"id":     "ev1",
+		"device": "dev1",
+		"ts":     "2017-07-14T02:40:00.4Z",
+		"readings": []interface{}{
+			map[string]interface{}{"id": "r1", "name": "temperature", "v": 21.5, "device": "dev1",
+				"origin": "2017-07-14T02:40:00.4Z"},
+			map[string]interface{}{"name": "state", "v": "idle"},
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatal("Unexpected event", doc)
+	}
+
+	doc = mapEvent(t, &export.JSONMapping{Include: []string{"device", "readings", "readings.name"}}, event)
+	expected = map[string]interface{}{
+		"device": "dev1",
+		"readings": []interface{}{
+			map[string]interface{}{"name": "temperature"},
+			map[string]interface{}{"name": "state"},
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatal("Unexpected event", doc)
+	}
+
+	// Renamed fields can be swapped
+	doc = mapEvent(t, &export.JSONMapping{
+		Include: []string{"id", "device"},
+		Rename:  map[string]string{"id": "device", "device": "id"},
+	}, event)
+	if !reflect.DeepEqual(doc, map[string]interface{}{"id": "dev1", "device": "ev1"}) {
+		t.Fatal("Unexpected event", doc)
+	}
+}
+
+func TestJSONMappingFlatten(t *testing.T) {
+	event := &export.Event{
+		Device: "thermostat",
+		Origin: 1500000000000,
+		Readings: []export.Reading{
+			{Name: "temperature", Value: "72"},
+			{Name: "humidity", Value: "58.5"},
+			{Name: "heating", Value: "true"},
+			{Name: "mode", Value: "auto"},
+			{Name: "device", Value: "hidden"},
+		},
+	}
+	mapping := &export.JSONMapping{
+		Flatten:     true,
+		TypedValues: true,
+		Exclude:     []string{"readings.name"},
+		Rename:      map[string]string{"heating": "heater"},
+	}
+	reg := export.Registration{Format: export.FormatJSON, Mapping: mapping}
+	f, _ := newFormater(reg)
+	data := string(f.Format(event))
+	if data != `{"device":"thermostat","heater":true,"humidity":58.5,"mode":"auto","temperature":72,"ts":1500000000000}` {
+		t.Fatal("Unexpected event", data)
+	}
+
+	mapping.TypedValues = false
+	mapping.TimeFormat = export.MappingTimeRFC3339
+	doc := mapEvent(t, mapping, event)
+	if doc["temperature"] != "72" || doc["heater"] != "true" || doc["ts"] != "2017-07-14T02:40:00Z" {
+		t.Fatal("Unexpected event", doc)
+	}
+
+	// Unset times are left out of RFC 3339 events
+	doc = mapEvent(t, mapping, &export.Event{Device: "thermostat"})
+	if !reflect.DeepEqual(doc, map[string]interface{}{"device": "thermostat"}) {
+		t.Fatal("Unexpected event", doc)
+	}
+}
+
+func TestJSONMappingValues(t *testing.T) {
+	m := newJSONMapping(&export.JSONMapping{TypedValues: true})
+	cases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"72", json.Number("72")},
+		{"-1.5e3", json.Number("-1.5e3")},
+		{"9007199254740993", json.Number("9007199254740993")},
+		{"+5", 5.0},
+		{"NaN", "NaN"},
+		{"Inf", "Inf"},
+		{"false", false},
+		{"True", "True"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if v := m.value(c.value); v != c.expected {
+			t.Fatal("Unexpected value", c.value, v)
+		}
+	}
+}
@@ -9,20 +9,29 @@
 package distro
 
 import (
+	"net"
 	"strconv"
+	"time"
 
 	"github.com/drasko/edgex-export"
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
 )
 
+const (
+	// Suffix of the topic published by connectivity tests
+	testTopicSuffix = "/test"
+	// Suffix of the client ID of connectivity tests
+	testClientIDSuffix = "-test"
+)
+
 type mqttSender struct {
 	client MQTT.Client
 	topic  string
+	addr   export.Addressable
 }
 
-// NewMqttSender - create new mqtt sender
-func NewMqttSender(addr export.Addressable) Sender {
+func mqttClientOptions(addr export.Addressable) *MQTT.ClientOptions {
 	opts := MQTT.NewClientOptions()
 	broker := "tcp://" + addr.Address + ":" + strconv.Itoa(addr.Port)
 	opts.AddBroker(broker)
@@ -30,16 +39,32 @@ func NewMqttSender(addr export.Addressable) Sender {
 	opts.SetUsername(addr.User)
 	opts.SetPassword(addr.Password)
 	opts.SetAutoReconnect(false)
+	return opts
+}
 
+// NewMqttSender - create new mqtt sender
+func NewMqttSender(addr export.Addressable) Sender {
 	sender := &mqttSender{
-		client: MQTT.NewClient(opts),
+		client: MQTT.NewClient(mqttClientOptions(addr)),
 		topic:  addr.Topic,
+		addr:   addr,
 	}
 
 	return sender
 }
 
 func (sender *mqttSender) Send(data []byte) {
+	sender.SendMessage(Message{Data: data})
+}
+
+// SendMessage - publish the payload of msg to its topic, or to the topic
+// of the sender if it has none. MQTT has no headers, they are ignored
+func (sender *mqttSender) SendMessage(msg Message) {
+	topic := sender.topic
+	if msg.Topic != "" {
+		topic = msg.Topic
+	}
+
 	if !sender.client.IsConnected() {
 		logger.Info("Connecting to mqtt server")
 		if token := sender.client.Connect(); token.Wait() && token.Error() != nil {
@@ -48,12 +73,65 @@ func (sender *mqttSender) Send(data []byte) {
 		}
 	}
 
-	token := sender.client.Publish(sender.topic, 0, false, data)
+	token := sender.client.Publish(topic, 0, false, msg.Data)
 	// FIXME: could be removed? set of tokens?
 	token.Wait()
 	if token.Error() != nil {
 		logger.Warn("mqtt error: ", zap.Error(token.Error()))
 	} else {
-		logger.Debug("Sent data: ", zap.ByteString("data", data))
+		logger.Debug("Sent data: ", zap.ByteString("data", msg.Data))
 	}
 }
+
+// waitToken - wait for token at most connectivityTimeout. Token.WaitTimeout
+// is not used, it holds the lock taken to set the error of the token
+func waitToken(token MQTT.Token) error {
+	done := make(chan struct{})
+	go func() {
+		token.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return token.Error()
+	case <-time.After(connectivityTimeout):
+		return errTestTimeout
+	}
+}
+
+// Test - connect and publish with QoS 1 to the topic of the sender followed
+// by testTopicSuffix. The test uses a client ID of its own, so the broker
+// does not drop the connection of the sender
+func (sender *mqttSender) Test(res *export.ConnectivityResult) {
+	hostport := net.JoinHostPort(sender.addr.Address, strconv.Itoa(sender.addr.Port))
+	res.Target = "tcp://" + hostport
+	if !dialStep(res, hostport) {
+		return
+	}
+
+	opts := mqttClientOptions(sender.addr)
+	opts.SetClientID(sender.addr.Publisher + testClientIDSuffix)
+	// No fallback to MQTT 3.1, which would hide why the connection failed
+	opts.SetProtocolVersion(4)
+	opts.SetConnectTimeout(connectivityTimeout)
+	client := MQTT.NewClient(opts)
+
+	connected := runStep(res, "connect", func() (string, error) {
+		token := client.Connect()
+		err := waitToken(token)
+		if err != nil && err != errTestTimeout {
+			err = connackError{code: token.(*MQTT.ConnectToken).ReturnCode(), err: err}
+		}
+		return "", err
+	})
+	if !connected {
+		return
+	}
+	defer client.Disconnect(250)
+
+	topic := sender.topic + testTopicSuffix
+	runStep(res, "publish", func() (string, error) {
+		return topic, waitToken(client.Publish(topic, 1, false, testPayload))
+	})
+}
@@ -14,6 +14,7 @@ package distro
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -36,128 +37,240 @@ func newRegistrationInfo() *registrationInfo {
 	return reg
 }
 
+// update - set the pipeline of newReg, recording in its status whether it
+// runs
 func (reg *registrationInfo) update(newReg export.Registration) bool {
-	reg.registration = newReg
+	ok := reg.updateSender(newReg)
+	statusUpdated(newReg.Name, reg.err)
+	return ok
+}
 
-	reg.format = nil
-	switch newReg.Format {
-	case export.FormatJSON:
-		reg.format = jsonFormater{}
-	case export.FormatXML:
-		reg.format = xmlFormater{}
-	case export.FormatSerialized:
-		// TODO reg.format = distro.NewSerializedFormat()
-	case export.FormatIoTCoreJSON:
-		// TODO reg.format = distro.NewIotCoreFormat()
-	case export.FormatAzureJSON:
-		// TODO reg.format = distro.NewAzureFormat()
-	case export.FormatCSV:
-		// TODO reg.format = distro.NewCsvFormat()
-	default:
-		logger.Warn("Format not supported: ", zap.String("format", newReg.Format))
+func (reg *registrationInfo) updateSender(newReg export.Registration) bool {
+	if !reg.updatePipeline(newReg) {
 		return false
 	}
 
-	reg.compression = nil
-	switch newReg.Compression {
-	case export.CompNone:
-		reg.compression = nil
-	case export.CompGzip:
-		reg.compression = &gzipTransformer{}
-	case export.CompZip:
-		reg.compression = &zlibTransformer{}
-	default:
-		logger.Warn("Compression not supported: ", zap.String("compression", newReg.Compression))
+	sender, err := newSender(newReg)
+	if err != nil {
+		logger.Warn("Destination not supported: ", zap.String("destination", newReg.Destination),
+			zap.Error(err))
+		reg.err = err
 		return false
 	}
+	reg.closeSender()
+	reg.sender = sender
+	return true
+}
 
-	reg.sender = nil
-	switch newReg.Destination {
-	case export.DestMQTT:
-		reg.sender = NewMqttSender(newReg.Addressable)
-	case export.DestZMQ:
-		logger.Info("Destination ZMQ is not supported")
-	case export.DestIotCoreMQTT:
-		// TODO reg.sender = distro.NewIotCoreSender("TODO URL")
-	case export.DestAzureMQTT:
-		// TODO reg.sender = distro.NewAzureSender("TODO URL")
-	case export.DestRest:
-		reg.sender = NewHTTPSender(newReg.Addressable)
-	default:
-		logger.Warn("Destination not supported: ", zap.String("destination", newReg.Destination))
-		return false
+// closeSender - close the sender, if it holds a session with the
+// destination
+func (reg *registrationInfo) closeSender() {
+	if c, ok := reg.sender.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logger.Warn("Failed to close sender", zap.Error(err))
+		}
 	}
-	reg.encrypt = nil
-	switch newReg.Encryption.Algo {
-	case export.EncNone:
-		reg.encrypt = nil
-	case export.EncAes:
-		reg.encrypt = NewAESEncryption(newReg.Encryption)
-	default:
-		logger.Warn("Encryption not supported: ", zap.String("Algorithm", newReg.Encryption.Algo))
+}
+
+// updatePipeline - set the stages that turn events into the payloads of
+// newReg, all but the sender. The stages are created by the registered
+// factories. The error of the failed stage is kept in err
+func (reg *registrationInfo) updatePipeline(newReg export.Registration) bool {
+	reg.registration = newReg
+	reg.err = nil
+
+	var err error
+	if reg.format, err = newFormater(newReg); err != nil {
+		logger.Warn("Format not supported: ", zap.String("format", newReg.Format), zap.Error(err))
+		reg.err = err
 		return false
 	}
+	if newReg.CloudEvents != nil {
+		reg.format = newCloudEventsFormater(reg.format, newReg)
+	}
 
-	reg.filter = nil
+	if reg.compression, err = newCompression(newReg); err != nil {
+		logger.Warn("Compression not supported: ", zap.String("compression", newReg.Compression),
+			zap.Error(err))
+		reg.err = err
+		return false
+	}
 
-	if len(newReg.Filter.DeviceIDs) > 0 {
-		reg.filter = append(reg.filter, newDevIdFilter(newReg.Filter))
-		logger.Debug("Device ID filter added: ", zap.Any("filters", newReg.Filter.DeviceIDs))
+	if reg.encrypt, err = newEncryption(newReg); err != nil {
+		logger.Warn("Encryption not supported: ", zap.String("Algorithm", newReg.Encryption.Algo),
+			zap.Error(err))
+		reg.err = err
+		return false
 	}
 
-	if len(newReg.Filter.ValueDescriptorIDs) > 0 {
-		reg.filter = append(reg.filter, newValueDescFilter(newReg.Filter))
-		logger.Debug("Value descriptor filter added: ", zap.Any("filters", newReg.Filter.ValueDescriptorIDs))
+	if reg.filter, err = newFilters(newReg); err != nil {
+		logger.Warn("Filter not supported: ", zap.Error(err))
+		reg.err = err
+		return false
 	}
+	logger.Debug("Filters added: ", zap.Int("filters", len(reg.filter)))
 
 	return true
 }
 
-func (reg registrationInfo) processEvent(event *export.Event) {
+// pipelineResult - output of each stage of the pipeline for an event
+type pipelineResult struct {
+	// Event after the filters, nil if filtered out
+	filtered   *export.Event
+	formatted  []byte
+	compressed []byte
+	encrypted  []byte
+	// Topic and headers set by message formats
+	topic   string
+	headers map[string]string
+	// Error of the format, if it failed
+	err error
+}
+
+// runPipeline - filter, format, compress and encrypt event
+func (reg registrationInfo) runPipeline(event *export.Event) pipelineResult {
+	res := pipelineResult{}
+
 	// Valid Event Filter, needed?
 
 	for _, f := range reg.filter {
 		var accepted bool
 		accepted, event = f.Filter(event)
 		if !accepted {
-			logger.Info("Event filtered")
-			return
+			return res
 		}
 	}
+	res.filtered = event
 
 	if reg.format == nil {
 		logger.Warn("registrationInfo with nil format")
+		return res
+	}
+	if f, ok := reg.format.(MessageFormater); ok {
+		msg, err := f.FormatMessage(event)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		res.formatted, res.topic, res.headers = msg.Data, msg.Topic, msg.Headers
+	} else {
+		res.formatted = reg.format.Format(event)
+	}
+	reg.transform(&res)
+	return res
+}
+
+// flushPipeline - compress and encrypt the payload of the pending events
+// of batch formats. ok is false if there are none
+func (reg registrationInfo) flushPipeline() (res pipelineResult, ok bool) {
+	b, ok := reg.format.(BatchFormater)
+	if !ok || b.Pending() == 0 {
+		return res, false
+	}
+	msg, err := b.Flush()
+	if err != nil {
+		res.err = err
+		return res, true
+	}
+	res.formatted, res.topic, res.headers = msg.Data, msg.Topic, msg.Headers
+	reg.transform(&res)
+	return res, true
+}
+
+// transform - compress and encrypt the formatted payload of res
+func (reg registrationInfo) transform(res *pipelineResult) {
+	if res.formatted == nil {
 		return
 	}
-	formated := reg.format.Format(event)
 
-	compressed := formated
+	res.compressed = res.formatted
 	if reg.compression != nil {
-		compressed = reg.compression.Transform(formated)
+		res.compressed = reg.compression.Transform(res.formatted)
 	}
 
-	encrypted := compressed
+	res.encrypted = res.compressed
 	if reg.encrypt != nil {
-		encrypted = reg.encrypt.Transform(compressed)
+		res.encrypted = reg.encrypt.Transform(res.compressed)
+	}
+}
+
+func (reg registrationInfo) processEvent(event *export.Event) {
+	res := reg.runPipeline(event)
+	if res.filtered == nil {
+		logger.Info("Event filtered")
+		return
+	}
+	if reg.send(res) {
+		logger.Debug("Sent event with registration:",
+			zap.Any("Event", event),
+			zap.String("Name", reg.registration.Name))
 	}
+}
 
-	reg.sender.Send(encrypted)
-	logger.Debug("Sent event with registration:",
-		zap.Any("Event", event),
-		zap.String("Name", reg.registration.Name))
+// flushBatch - send the pending events of batch formats
+func (reg registrationInfo) flushBatch() {
+	if res, ok := reg.flushPipeline(); ok && reg.send(res) {
+		logger.Debug("Sent batch with registration:",
+			zap.String("Name", reg.registration.Name))
+	}
+}
+
+// send - send the payload of res, if the format returned one, recording
+// the result in the status of the registration
+func (reg registrationInfo) send(res pipelineResult) bool {
+	if res.err != nil {
+		logger.Warn("Failed to format event", zap.String("Name", reg.registration.Name),
+			zap.Error(res.err))
+		statusEventFailed(reg.registration.Name, res.err)
+		return false
+	}
+	if res.formatted == nil {
+		return false
+	}
+
+	if s, ok := reg.sender.(MessageSender); ok && (res.topic != "" || res.headers != nil) {
+		s.SendMessage(Message{Data: res.encrypted, Topic: res.topic, Headers: res.headers})
+	} else {
+		reg.sender.Send(res.encrypted)
+	}
+	statusSent(reg.registration.Name)
+	return true
+}
+
+// batchTimer - channel of the flush of the pending events of batch
+// formats, started by the first pending one, and nil without any
+func (reg registrationInfo) batchTimer(flush <-chan time.Time) <-chan time.Time {
+	b, ok := reg.format.(BatchFormater)
+	switch {
+	case !ok || b.Pending() == 0:
+		return nil
+	case flush == nil:
+		return time.After(b.Interval())
+	}
+	return flush
 }
 
 func registrationLoop(reg *registrationInfo) {
 	logger.Info("registration loop started",
 		zap.String("Name", reg.registration.Name))
+	var flush <-chan time.Time
 	for {
 		select {
 		case event := <-reg.chEvent:
 			reg.processEvent(event)
+			flush = reg.batchTimer(flush)
+
+		case <-flush:
+			reg.flushBatch()
+			flush = nil
 
 		case newReg := <-reg.chRegistration:
+			// The pending events are sent with the previous pipeline
+			reg.flushBatch()
+			flush = nil
 			if newReg == nil {
 				logger.Info("Terminating registration goroutine")
+				reg.closeSender()
 				return
 			} else {
 				if reg.update(*newReg) {
@@ -174,6 +287,25 @@ func registrationLoop(reg *registrationInfo) {
 	}
 }
 
+// startOrUpdateRegistration - send the registration to its running
+// goroutine, or start a new one if it is not running
+func startOrUpdateRegistration(running map[string]*registrationInfo,
+	reg *export.Registration) {
+
+	if v, ok := running[reg.Name]; ok && !v.deleteMe {
+		v.chRegistration <- reg
+		return
+	}
+
+	regInfo := newRegistrationInfo()
+	if regInfo.update(*reg) {
+		running[reg.Name] = regInfo
+		go registrationLoop(regInfo)
+	} else {
+		delete(running, reg.Name)
+	}
+}
+
 func updateRunningRegistrations(running map[string]*registrationInfo,
 	update export.NotifyUpdate) {
 
@@ -181,41 +313,68 @@ func updateRunningRegistrations(running map[string]*registrationInfo,
 	case export.NotifyUpdateDelete:
 		for k, v := range running {
 			if k == update.Name {
-				v.chRegistration <- nil
+				if !v.deleteMe {
+					v.chRegistration <- nil
+				}
 				delete(running, k)
+				statusDeleted(k)
 				return
 			}
 		}
 		logger.Warn("delete update not processed")
-	case export.NotifyUpdateUpdate:
+	case export.NotifyUpdateUpdate, export.NotifyUpdateAdd:
+		// Watches may replay changes, so an add of a running registration
+		// is handled as an update and the other way around
 		reg := getRegistrationByName(update.Name)
 		if reg == nil {
 			logger.Error("Could not find registration", zap.String("name", update.Name))
 			return
 		}
-		for k, v := range running {
-			if k == update.Name {
-				v.chRegistration <- reg
-				return
+		startOrUpdateRegistration(running, reg)
+	case export.NotifyUpdateRename:
+		// Keep the pipeline running under the new name
+		if v, ok := running[update.Name]; ok {
+			delete(running, update.Name)
+			// Stop the pipeline running under the new name, it would be
+			// left running with no entry
+			if old, ok := running[update.NewName]; ok && !old.deleteMe {
+				old.chRegistration <- nil
 			}
+			running[update.NewName] = v
 		}
-		logger.Error("Could not find running registration", zap.String("name", update.Name))
-	case export.NotifyUpdateAdd:
-		reg := getRegistrationByName(update.Name)
+		statusDeleted(update.Name)
+		reg := getRegistrationByName(update.NewName)
 		if reg == nil {
-			logger.Error("Could not find registration", zap.String("name", update.Name))
+			logger.Error("Could not find registration", zap.String("name", update.NewName))
 			return
 		}
-		regInfo := newRegistrationInfo()
-		if regInfo.update(*reg) {
-			running[reg.Name] = regInfo
-			go registrationLoop(regInfo)
-		}
+		startOrUpdateRegistration(running, reg)
 	default:
 		logger.Error("Invalid update operation", zap.String("operation", update.Operation))
 	}
 }
 
+// resyncRunningRegistrations - make the running registrations match regs
+func resyncRunningRegistrations(running map[string]*registrationInfo,
+	regs []export.Registration) {
+
+	names := make(map[string]bool)
+	for i := range regs {
+		names[regs[i].Name] = true
+		startOrUpdateRegistration(running, &regs[i])
+	}
+
+	for k, v := range running {
+		if !names[k] {
+			if !v.deleteMe {
+				v.chRegistration <- nil
+			}
+			delete(running, k)
+			statusDeleted(k)
+		}
+	}
+}
+
 // Loop - registration loop
 func Loop(config Config, errChan chan error, eventCh chan *export.Event) {
 
@@ -228,17 +387,29 @@ func Loop(config Config, errChan chan error, eventCh chan *export.Event) {
 
 	registrations := make(map[string]*registrationInfo)
 
-	allRegs := getRegistrations()
-
-	for allRegs == nil {
-		logger.Info("Waiting for client microservice")
-		select {
-		case e := <-errChan:
-			logger.Info("exit msg", zap.Error(e))
-			return
-		case <-time.After(time.Second):
+	done := make(chan struct{})
+	defer close(done)
+
+	var allRegs []export.Registration
+	if cfg.RegistrationDir != "" {
+		// The first load is received as a resync
+		go watchRegistrationDir(cfg.RegistrationDir, done)
+	} else {
+		var token string
+		token, allRegs = syncRegistrations()
+
+		for allRegs == nil {
+			logger.Info("Waiting for client microservice")
+			select {
+			case e := <-errChan:
+				logger.Info("exit msg", zap.Error(e))
+				return
+			case <-time.After(time.Second):
+			}
+			token, allRegs = syncRegistrations()
 		}
-		allRegs = getRegistrations()
+
+		go watchRegistrations(token, done)
 	}
 
 	// Create new goroutines for each registration
@@ -269,6 +440,10 @@ func Loop(config Config, errChan chan error, eventCh chan *export.Event) {
 			logger.Info("Registration changes")
 			updateRunningRegistrations(registrations, update)
 
+		case regs := <-registrationResync:
+			logger.Info("Registration resync")
+			resyncRunningRegistrations(registrations, regs)
+
 		case event := <-eventCh:
 			logger.Info("EVENT")
 			for k, reg := range registrations {
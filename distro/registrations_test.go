@@ -9,8 +9,10 @@ package distro
 import (
 	"github.com/drasko/edgex-export"
 
-	// "go.uber.org/zap"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 func validRegistration() export.Registration {
@@ -150,3 +152,33 @@ func TestRegistrationInfoLoop(t *testing.T) {
 	// Process an event and terminate
 	registrationLoop(ri)
 }
+
+func TestRenameStopsReplacedRegistration(t *testing.T) {
+	logger = zap.NewNop()
+
+	renamed, replaced := newRegistrationInfo(), newRegistrationInfo()
+	running := map[string]*registrationInfo{"old": renamed, "new": replaced}
+	stopped := make(chan *export.Registration, 1)
+	go func() {
+		stopped <- <-replaced.chRegistration
+	}()
+
+	// The registration is not found in the client, so only the pipelines
+	// are moved
+	updateRunningRegistrations(running, export.NotifyUpdate{
+		Name:      "old",
+		NewName:   "new",
+		Operation: export.NotifyUpdateRename,
+	})
+	select {
+	case reg := <-stopped:
+		if reg != nil {
+			t.Fatal("Replaced registration should be terminated", reg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Replaced registration should be terminated")
+	}
+	if len(running) != 1 || running["new"] != renamed {
+		t.Fatal("Renamed registration should run under the new name", running)
+	}
+}
@@ -0,0 +1,247 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/drasko/edgex-export"
+)
+
+// FormatFactory - create the Formater of a registration
+type FormatFactory func(reg export.Registration) (Formater, error)
+
+// TransformerFactory - create the compression or encryption Transformer of
+// a registration. A nil Transformer leaves the data unchanged
+type TransformerFactory func(reg export.Registration) (Transformer, error)
+
+// SenderFactory - create the Sender of a registration
+type SenderFactory func(reg export.Registration) (Sender, error)
+
+// FilterFactory - create the Filterer of a registration, or nil if the
+// registration does not use the filter
+type FilterFactory func(reg export.Registration) (Filterer, error)
+
+// stageRegistry - factories of a pipeline stage by name, with the
+// capabilities they are published with in registration order
+type stageRegistry struct {
+	sync.RWMutex
+	caps      []export.Capability
+	factories map[string]interface{}
+}
+
+func (r *stageRegistry) register(name string, factory interface{}, params []export.Parameter) {
+	r.Lock()
+	defer r.Unlock()
+
+	c := export.Capability{Name: name, Parameters: params}
+	if _, ok := r.factories[name]; ok {
+		for i := range r.caps {
+			if r.caps[i].Name == name {
+				r.caps[i] = c
+			}
+		}
+	} else {
+		r.caps = append(r.caps, c)
+	}
+	r.factories[name] = factory
+}
+
+func (r *stageRegistry) factory(name string) (interface{}, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	f, ok := r.factories[name]
+	return f, ok
+}
+
+// all - factories in registration order
+func (r *stageRegistry) all() []interface{} {
+	r.RLock()
+	defer r.RUnlock()
+	res := make([]interface{}, len(r.caps))
+	for i, c := range r.caps {
+		res[i] = r.factories[c.Name]
+	}
+	return res
+}
+
+func (r *stageRegistry) capabilities() []export.Capability {
+	r.RLock()
+	defer r.RUnlock()
+	return append([]export.Capability{}, r.caps...)
+}
+
+func newStageRegistry() *stageRegistry {
+	return &stageRegistry{factories: make(map[string]interface{})}
+}
+
+var (
+	formats      = newStageRegistry()
+	compressions = newStageRegistry()
+	algorithms   = newStageRegistry()
+	destinations = newStageRegistry()
+	filters      = newStageRegistry()
+)
+
+// RegisterFormat - add a format, or replace the one with the same name.
+// params are the registration fields configuring the format, published in
+// the capabilities and checked when validating registrations. Formats, as
+// the other stages, must be registered before calling Loop
+func RegisterFormat(name string, factory FormatFactory, params ...export.Parameter) {
+	formats.register(name, factory, params)
+}
+
+// RegisterCompression - add or replace a compression
+func RegisterCompression(name string, factory TransformerFactory, params ...export.Parameter) {
+	compressions.register(name, factory, params)
+}
+
+// RegisterEncryption - add or replace an encryption algorithm
+func RegisterEncryption(name string, factory TransformerFactory, params ...export.Parameter) {
+	algorithms.register(name, factory, params)
+}
+
+// RegisterDestination - add or replace a destination
+func RegisterDestination(name string, factory SenderFactory, params ...export.Parameter) {
+	destinations.register(name, factory, params)
+}
+
+// RegisterFilter - add or replace a filter. Every filter is asked for a
+// Filterer for each registration, in registration order
+func RegisterFilter(name string, factory FilterFactory, params ...export.Parameter) {
+	filters.register(name, factory, params)
+}
+
+func newFormater(reg export.Registration) (Formater, error) {
+	f, ok := formats.factory(reg.Format)
+	if !ok {
+		return nil, errors.New("unknown format " + reg.Format)
+	}
+	return f.(FormatFactory)(reg)
+}
+
+func newCompression(reg export.Registration) (Transformer, error) {
+	f, ok := compressions.factory(reg.Compression)
+	if !ok {
+		return nil, errors.New("unknown compression " + reg.Compression)
+	}
+	return f.(TransformerFactory)(reg)
+}
+
+func newEncryption(reg export.Registration) (Transformer, error) {
+	f, ok := algorithms.factory(reg.Encryption.Algo)
+	if !ok {
+		return nil, errors.New("unknown algorithm " + reg.Encryption.Algo)
+	}
+	return f.(TransformerFactory)(reg)
+}
+
+func newSender(reg export.Registration) (Sender, error) {
+	f, ok := destinations.factory(reg.Destination)
+	if !ok {
+		return nil, errors.New("unknown destination " + reg.Destination)
+	}
+	return f.(SenderFactory)(reg)
+}
+
+func newFilters(reg export.Registration) ([]Filterer, error) {
+	var res []Filterer
+	for _, f := range filters.all() {
+		filter, err := f.(FilterFactory)(reg)
+		if err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			res = append(res, filter)
+		}
+	}
+	return res, nil
+}
+
+// defaultParameters - parameters of the capability name in caps
+func defaultParameters(caps []export.Capability, name string) []export.Parameter {
+	for _, c := range caps {
+		if c.Name == name {
+			return c.Parameters
+		}
+	}
+	return nil
+}
+
+// Built in stages
+func init() {
+	defaults := export.DefaultCapabilities()
+
+	RegisterFormat(export.FormatJSON, newJSONFormater,
+		defaultParameters(defaults.Formats, export.FormatJSON)...)
+	RegisterFormat(export.FormatXML, newXMLFormater,
+		defaultParameters(defaults.Formats, export.FormatXML)...)
+	RegisterFormat(export.FormatMsgPack, func(export.Registration) (Formater, error) {
+		return newMsgPackFormater(), nil
+	})
+	RegisterFormat(export.FormatCBOR, func(export.Registration) (Formater, error) {
+		return newCBORFormater(), nil
+	})
+	RegisterFormat(export.FormatAvro, newAvroFormater)
+	RegisterFormat(export.FormatAvroOCF, newAvroContainerFormater,
+		defaultParameters(defaults.Formats, export.FormatAvroOCF)...)
+	RegisterFormat(export.FormatScript, newScriptFormater,
+		defaultParameters(defaults.Formats, export.FormatScript)...)
+	RegisterFormat(export.FormatTemplate, newTemplateFormater,
+		defaultParameters(defaults.Formats, export.FormatTemplate)...)
+	RegisterFormat(export.FormatSenMLJSON, newSenMLFormater(false),
+		defaultParameters(defaults.Formats, export.FormatSenMLJSON)...)
+	RegisterFormat(export.FormatSenMLCBOR, newSenMLFormater(true),
+		defaultParameters(defaults.Formats, export.FormatSenMLCBOR)...)
+	RegisterFormat(export.FormatInfluxLine, newInfluxFormater,
+		defaultParameters(defaults.Formats, export.FormatInfluxLine)...)
+	RegisterFormat(export.FormatSparkplugB, newSparkplugFormater,
+		defaultParameters(defaults.Formats, export.FormatSparkplugB)...)
+
+	RegisterCompression(export.CompNone, func(export.Registration) (Transformer, error) {
+		return nil, nil
+	})
+	RegisterCompression(export.CompGzip, func(export.Registration) (Transformer, error) {
+		return &gzipTransformer{}, nil
+	})
+	RegisterCompression(export.CompZip, func(export.Registration) (Transformer, error) {
+		return &zlibTransformer{}, nil
+	})
+
+	RegisterEncryption(export.EncNone, func(export.Registration) (Transformer, error) {
+		return nil, nil
+	})
+	RegisterEncryption(export.EncAes, func(reg export.Registration) (Transformer, error) {
+		return NewAESEncryption(reg.Encryption), nil
+	}, defaultParameters(defaults.Algorithms, export.EncAes)...)
+
+	RegisterDestination(export.DestMQTT, func(reg export.Registration) (Sender, error) {
+		if reg.Format == export.FormatSparkplugB {
+			return newSparkplugSender(reg)
+		}
+		return NewMqttSender(reg.Addressable), nil
+	}, defaultParameters(defaults.Destinations, export.DestMQTT)...)
+	RegisterDestination(export.DestRest, func(reg export.Registration) (Sender, error) {
+		return NewHTTPSender(reg.Addressable), nil
+	}, defaultParameters(defaults.Destinations, export.DestRest)...)
+	RegisterDestination(export.DestInfluxDB, newInfluxSender,
+		defaultParameters(defaults.Destinations, export.DestInfluxDB)...)
+
+	RegisterFilter(export.FilterDevice, func(reg export.Registration) (Filterer, error) {
+		if len(reg.Filter.DeviceIDs) == 0 {
+			return nil, nil
+		}
+		return newDevIdFilter(reg.Filter), nil
+	}, defaultParameters(defaults.Filters, export.FilterDevice)...)
+	RegisterFilter(export.FilterValueDescriptor, func(reg export.Registration) (Filterer, error) {
+		if len(reg.Filter.ValueDescriptorIDs) == 0 {
+			return nil, nil
+		}
+		return newValueDescFilter(reg.Filter), nil
+	}, defaultParameters(defaults.Filters, export.FilterValueDescriptor)...)
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+type deviceFormater struct{}
+
+func (deviceFormater) Format(event *export.Event) []byte {
+	return []byte(event.Device)
+}
+
+type captureSender struct {
+	sent *[][]byte
+}
+
+func (s captureSender) Send(data []byte) {
+	*s.sent = append(*s.sent, data)
+}
+
+func TestRegistry(t *testing.T) {
+	logger = zap.NewNop()
+
+	var sent [][]byte
+	RegisterFormat("TEST_DEVICE", func(export.Registration) (Formater, error) {
+		return deviceFormater{}, nil
+	})
+	RegisterDestination("TEST_CAPTURE", func(reg export.Registration) (Sender, error) {
+		if reg.Addressable.Topic == "fail" {
+			return nil, errors.New("invalid topic")
+		}
+		return captureSender{sent: &sent}, nil
+	}, export.Parameter{Field: "addressable.Topic", Required: true})
+	// Replaced, and still published once
+	RegisterFormat("TEST_DEVICE", func(export.Registration) (Formater, error) {
+		return deviceFormater{}, nil
+	})
+
+	caps := capabilities()
+	count := 0
+	for _, name := range export.Names(caps.Formats) {
+		if name == "TEST_DEVICE" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatal("Format should be published once", caps.Formats)
+	}
+
+	reg := export.Registration{
+		Name:        "custom",
+		Format:      "TEST_DEVICE",
+		Destination: "TEST_CAPTURE",
+	}
+	if err := reg.ValidateWith(caps); err == nil {
+		t.Fatal("Parameters of registered destinations should be validated")
+	}
+	reg.Addressable.Topic = "topic"
+	if err := reg.ValidateWith(caps); err != nil {
+		t.Fatal("Registration should be valid", err)
+	}
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.update(reg) {
+		t.Fatal("Registration should be updated")
+	}
+	regInfo.processEvent(&export.Event{Device: "dev1"})
+	if len(sent) != 1 || !bytes.Equal(sent[0], []byte("dev1")) {
+		t.Fatal("Event should be sent by the registered stages", sent)
+	}
+
+	reg.Addressable.Topic = "fail"
+	if regInfo.update(reg) {
+		t.Fatal("Factory errors should fail the update")
+	}
+}
@@ -0,0 +1,567 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"github.com/yuin/gopher-lua/pm"
+	"go.uber.org/zap"
+)
+
+const (
+	// Time a call of the script may run if the registration does not set it
+	defaultScriptTimeout = 100 * time.Millisecond
+	// MB a call of the script may allocate if the registration does not set it
+	defaultScriptMemoryLimit = 64
+	// Lua stack slots of a script if the registration does not set it. They
+	// bound the depth of the values of the script, not its memory
+	defaultScriptStackLimit = 64 * 1024
+	// Period of the checks of the memory allocated by a call
+	scriptMemoryInterval = time.Millisecond
+	// Longest number formatted by string.format, without its width
+	maxFormattedNumber = 400
+	// Depth of the Lua call stack
+	scriptCallDepth = 200
+	// Deepest table json.encode converts
+	maxJSONDepth = 200
+	// Largest payload a script may return
+	maxScriptPayload = 1024 * 1024
+	// Function defined by the scripts
+	scriptFunction = "transform"
+	// Cumulative bytes allocated by the process
+	heapAllocsMetric = "/gc/heap/allocs:bytes"
+)
+
+// Globals of the base library removed from the scripts, which would read
+// files or load code
+var scriptRemovedGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module"}
+
+// Tables json.encode can not convert
+var (
+	errCyclicTable = errors.New("cyclic table")
+	errTableDepth  = errors.New("table nested too deeply")
+)
+
+// scriptFormater - format running a Lua script for each event. The script
+// is compiled once, and its state kept between events unless a call fails.
+// memoryLimit is in bytes
+type scriptFormater struct {
+	proto       *lua.FunctionProto
+	timeout     time.Duration
+	memoryLimit int
+	stackLimit  int
+	state       *lua.LState
+}
+
+// newScriptFormater - compile the script of reg, failing if it does not
+// compile or does not define the transform function
+func newScriptFormater(reg export.Registration) (Formater, error) {
+	if reg.Script == nil || reg.Script.Source == "" {
+		return nil, errors.New("script is required for " + export.FormatScript)
+	}
+	switch reg.Script.Language {
+	case "", export.ScriptLua:
+	default:
+		return nil, errors.New("unknown script language " + reg.Script.Language)
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(reg.Script.Source), reg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("script: %v", err)
+	}
+	proto, err := lua.Compile(chunk, reg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("script: %v", err)
+	}
+
+	f := &scriptFormater{
+		proto:       proto,
+		timeout:     defaultScriptTimeout,
+		memoryLimit: defaultScriptMemoryLimit << 20,
+		stackLimit:  defaultScriptStackLimit,
+	}
+	if reg.Script.Timeout > 0 {
+		f.timeout = time.Duration(reg.Script.Timeout) * time.Millisecond
+	}
+	if reg.Script.MemoryLimit > 0 {
+		f.memoryLimit = reg.Script.MemoryLimit << 20
+	}
+	if reg.Script.StackLimit > 0 {
+		f.stackLimit = reg.Script.StackLimit
+	}
+
+	if err := f.reset(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reset - create a new state and run the script in it, which defines the
+// transform function
+func (f *scriptFormater) reset() error {
+	if f.state != nil {
+		f.state.Close()
+		f.state = nil
+	}
+
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   scriptCallDepth,
+		RegistrySize:    1024,
+		RegistryMaxSize: f.stackLimit,
+	})
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range scriptRemovedGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("json", f.jsonModule(L))
+	f.limitResults(L)
+
+	err := f.call(L, func() error {
+		L.Push(L.NewFunctionFromProto(f.proto))
+		return L.PCall(0, 0, nil)
+	})
+	if err != nil {
+		L.Close()
+		return fmt.Errorf("script: %v", err)
+	}
+	if _, ok := L.GetGlobal(scriptFunction).(*lua.LFunction); !ok {
+		L.Close()
+		return errors.New("script: function " + scriptFunction + " is not defined")
+	}
+
+	f.state = L
+	return nil
+}
+
+// call - run fn, which calls the script in L. The script is stopped past
+// the timeout or once distro allocated more than the memory limit during
+// the call, which is not only the memory of the script
+func (f *scriptFormater) call(L *lua.LState, fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	exceeded := watchAllocations(ctx, cancel, f.memoryLimit)
+	L.SetContext(ctx)
+	err := fn()
+	L.RemoveContext()
+
+	switch {
+	case err == nil:
+		return nil
+	case exceeded():
+		return fmt.Errorf("stopped after distro allocated more than %d MB during the call",
+			f.memoryLimit>>20)
+	case ctx.Err() == context.DeadlineExceeded:
+		return errors.New("timed out")
+	}
+	return err
+}
+
+// watchAllocations - cancel the call running with ctx once the memory
+// allocated since it started exceeds limit bytes. The Lua VM has no
+// allocation hook, so the allocations of the process are sampled, and the
+// events processed meanwhile by other registrations count as well. The
+// returned function tells if the limit was exceeded
+func watchAllocations(ctx context.Context, cancel context.CancelFunc, limit int) func() bool {
+	var exceeded int32
+	start := heapAllocations()
+	go func() {
+		ticker := time.NewTicker(scriptMemoryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if heapAllocations()-start > uint64(limit) {
+					atomic.StoreInt32(&exceeded, 1)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return func() bool {
+		return atomic.LoadInt32(&exceeded) == 1
+	}
+}
+
+func heapAllocations() uint64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// checkSize - fail the call if a result of size bytes would exceed the
+// memory limit. It is checked before the library functions which can
+// return results much larger than their arguments allocate them, as the
+// sampling would only see them once allocated
+func (f *scriptFormater) checkSize(L *lua.LState, size float64) {
+	if size > float64(f.memoryLimit) {
+		L.RaiseError("memory limit of %d MB exceeded", f.memoryLimit>>20)
+	}
+}
+
+// limitResults - replace the library functions with results which can be
+// much larger than their arguments by ones checking the size of the
+// results first. The string methods share the string table
+func (f *scriptFormater) limitResults(L *lua.LState) {
+	str := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	tab := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+
+	sized := func(lib *lua.LTable, name string, size func(L *lua.LState) float64) {
+		fn := lib.RawGetString(name)
+		lib.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+			f.checkSize(L, size(L))
+			top := L.GetTop()
+			L.Push(fn)
+			for i := 1; i <= top; i++ {
+				L.Push(L.Get(i))
+			}
+			L.Call(top, lua.MultRet)
+			return L.GetTop() - top
+		}))
+	}
+	sized(str, "rep", repSize)
+	sized(str, "format", formatSize)
+	sized(tab, "concat", concatSize)
+
+	gsub := str.RawGetString("gsub")
+	str.RawSetString("gsub", L.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		switch repl := L.Get(3).(type) {
+		case lua.LString:
+			f.checkSize(L, gsubSize(L, s, string(repl)))
+		case *lua.LTable, *lua.LFunction:
+			// Replacements are existing values, which can be used for
+			// each match, so their sizes are added up as they are made
+			total := len(s)
+			L.Replace(3, L.NewFunction(func(L *lua.LState) int {
+				var v lua.LValue
+				if t, ok := repl.(*lua.LTable); ok {
+					v = L.GetTable(t, L.Get(1))
+				} else {
+					top := L.GetTop()
+					L.Push(repl)
+					for i := 1; i <= top; i++ {
+						L.Push(L.Get(i))
+					}
+					L.Call(top, 1)
+					v = L.Get(-1)
+				}
+				if !lua.LVIsFalse(v) {
+					total += len(lua.LVAsString(v))
+					f.checkSize(L, float64(total))
+				}
+				L.Push(v)
+				return 1
+			}))
+		}
+		top := L.GetTop()
+		L.Push(gsub)
+		for i := 1; i <= top; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(top, lua.MultRet)
+		return L.GetTop() - top
+	}))
+}
+
+// repSize - size of string.rep(s, n)
+func repSize(L *lua.LState) float64 {
+	return float64(len(L.CheckString(1))) * float64(L.CheckInt(2))
+}
+
+// concatSize - size of table.concat(t, sep, i, j), for the range it
+// concatenates
+func concatSize(L *lua.LState) float64 {
+	t := L.CheckTable(1)
+	sep := L.OptString(2, "")
+	n := t.Len()
+	i, j := L.OptInt(3, 1), L.OptInt(4, n)
+	if i < 1 {
+		i = 1
+	}
+	if j > n {
+		j = n
+	}
+	size := 0.0
+	for k := i; k <= j; k++ {
+		size += float64(len(lua.LVAsString(t.RawGetInt(k))) + len(sep))
+	}
+	return size
+}
+
+// formatSize - largest size of string.format(format, ...): the format,
+// the string arguments, the widths and precisions and the longest number
+// for each verb
+func formatSize(L *lua.LState) float64 {
+	format := L.CheckString(1)
+	size := float64(len(format))
+	for i := 2; i <= L.GetTop(); i++ {
+		if s, ok := L.Get(i).(lua.LString); ok {
+			size += float64(len(s))
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		size += maxFormattedNumber
+		n := 0
+		for i++; i < len(format) && strings.IndexByte("-+ #0.123456789", format[i]) >= 0; i++ {
+			if format[i] >= '0' && format[i] <= '9' {
+				n = n*10 + int(format[i]-'0')
+				continue
+			}
+			size += float64(n)
+			n = 0
+		}
+		size += float64(n)
+	}
+	return size
+}
+
+// gsubSize - largest size of string.gsub(s, pattern, repl, n), with repl
+// a string: each match is replaced by repl, with its captures at most as
+// long as the match
+func gsubSize(L *lua.LState, s, repl string) float64 {
+	matches, err := pm.Find(L.CheckString(2), []byte(s), 0, L.OptInt(4, -1))
+	if err != nil {
+		// Reported by string.gsub
+		return 0
+	}
+	captures := strings.Count(repl, "%")
+	return float64(len(s)) + float64(len(matches))*float64(len(repl)) + float64(captures)*float64(len(s))
+}
+
+func (f *scriptFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Warn("Script failed", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - call transform with the event as a table. It returns the
+// payload, and optionally the topic and a table of headers. A nil payload
+// drops the event
+func (f *scriptFormater) FormatMessage(event *export.Event) (Message, error) {
+	msg := Message{}
+	if f.state == nil {
+		if err := f.reset(); err != nil {
+			return msg, err
+		}
+	}
+	L := f.state
+
+	arg, err := goToLua(L, event)
+	if err != nil {
+		return msg, err
+	}
+
+	err = f.call(L, func() error {
+		return L.CallByParam(lua.P{Fn: L.GetGlobal(scriptFunction), NRet: 3, Protect: true}, arg)
+	})
+	if err != nil {
+		// The state may be left inconsistent, the next call starts again
+		f.state.Close()
+		f.state = nil
+		return msg, fmt.Errorf("script: %v", err)
+	}
+
+	payload, topic, headers := L.Get(-3), L.Get(-2), L.Get(-1)
+	L.Pop(3)
+
+	switch p := payload.(type) {
+	case *lua.LNilType:
+		return msg, nil
+	case lua.LString:
+		if len(p) > maxScriptPayload {
+			return msg, fmt.Errorf("script: payload larger than %d bytes", maxScriptPayload)
+		}
+		msg.Data = []byte(p)
+	default:
+		return msg, errors.New("script: payload must be a string, got " + payload.Type().String())
+	}
+
+	switch t := topic.(type) {
+	case *lua.LNilType:
+	case lua.LString:
+		msg.Topic = string(t)
+	default:
+		return msg, errors.New("script: topic must be a string, got " + topic.Type().String())
+	}
+
+	switch h := headers.(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		msg.Headers = make(map[string]string)
+		h.ForEach(func(k, v lua.LValue) {
+			msg.Headers[k.String()] = v.String()
+		})
+	default:
+		return msg, errors.New("script: headers must be a table, got " + headers.Type().String())
+	}
+	return msg, nil
+}
+
+// jsonModule - json.encode and json.decode for the scripts
+func (f *scriptFormater) jsonModule(L *lua.LState) *lua.LTable {
+	return L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"encode": func(L *lua.LState) int {
+			v, err := luaToGo(L.CheckAny(1), map[*lua.LTable]bool{}, 0)
+			if err != nil {
+				L.RaiseError("json.encode: %v", err)
+			}
+			f.checkSize(L, jsonSize(v))
+			data, err := json.Marshal(v)
+			if err != nil {
+				L.RaiseError("json.encode: %v", err)
+			}
+			L.Push(lua.LString(data))
+			return 1
+		},
+		"decode": func(L *lua.LState) int {
+			var v interface{}
+			if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+				L.RaiseError("json.decode: %v", err)
+			}
+			L.Push(jsonToLua(L, v))
+			return 1
+		},
+	})
+}
+
+// goToLua - v as Lua tables, through its JSON document
+func goToLua(L *lua.LState, v interface{}) (lua.LValue, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return lua.LNil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return lua.LNil, err
+	}
+	return jsonToLua(L, doc), nil
+}
+
+func jsonToLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case bool:
+		return lua.LBool(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(jsonToLua(L, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for k, item := range v {
+			t.RawSetString(k, jsonToLua(L, item))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// jsonSize - largest size of the JSON document of v, with every character
+// of the strings escaped
+func jsonSize(v interface{}) float64 {
+	switch v := v.(type) {
+	case string:
+		return float64(2 + 6*len(v))
+	case []interface{}:
+		size := 2.0
+		for _, item := range v {
+			size += jsonSize(item) + 1
+		}
+		return size
+	case map[string]interface{}:
+		size := 2.0
+		for k, item := range v {
+			size += jsonSize(k) + jsonSize(item) + 2
+		}
+		return size
+	}
+	return maxFormattedNumber
+}
+
+// luaToGo - value to encode as JSON. Tables with the keys 1 to n are
+// arrays, other tables objects. path has the tables being converted, to
+// reject cyclic tables, and depth is their number
+func luaToGo(v lua.LValue, path map[*lua.LTable]bool, depth int) (interface{}, error) {
+	switch v := v.(type) {
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LBool:
+		return bool(v), nil
+	case *lua.LTable:
+		if path[v] {
+			return nil, errCyclicTable
+		}
+		if depth >= maxJSONDepth {
+			return nil, errTableDepth
+		}
+		path[v] = true
+		defer delete(path, v)
+
+		if n := v.Len(); n > 0 {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				item, err := luaToGo(v.RawGetInt(i), path, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			return list, nil
+		}
+		obj := make(map[string]interface{})
+		var err error
+		v.ForEach(func(k, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			obj[k.String()], err = luaToGo(value, path, depth+1)
+		})
+		return obj, err
+	}
+	return nil, nil
+}
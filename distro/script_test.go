@@ -0,0 +1,343 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+func scriptRegistration(source string) export.Registration {
+	return export.Registration{
+		Name:   "script",
+		Format: export.FormatScript,
+		Script: &export.ScriptDetails{Source: source, Timeout: 50},
+	}
+}
+
+func scriptEvent() *export.Event {
+	return &export.Event{
+		Device: "dev1",
+		Readings: []export.Reading{
+			{Name: "temperature", Value: "21.5"},
+			{Name: "humidity", Value: "40"},
+		},
+	}
+}
+
+func TestScriptFormat(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newScriptFormater(scriptRegistration(`
+local count = 0
+
+function transform(event)
+	if event.device == "skip" then
+		return nil
+	end
+	count = count + 1
+	local out = {device = event.device, count = count, values = {}}
+	for _, r in ipairs(event.readings) do
+		out.values[r.name] = tonumber(r.value)
+	end
+	return json.encode(out), "devices/" .. event.device, {["X-Count"] = count}
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf := f.(MessageFormater)
+
+	msg, err := mf.FormatMessage(scriptEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(msg.Data), `"temperature":21.5`) || msg.Topic != "devices/dev1" ||
+		msg.Headers["X-Count"] != "1" {
+		t.Fatal("Unexpected message", string(msg.Data), msg.Topic, msg.Headers)
+	}
+
+	// The state is kept between events
+	msg, _ = mf.FormatMessage(scriptEvent())
+	if msg.Headers["X-Count"] != "2" {
+		t.Fatal("Script state should be kept", msg.Headers)
+	}
+
+	msg, err = mf.FormatMessage(&export.Event{Device: "skip"})
+	if err != nil || msg.Data != nil {
+		t.Fatal("Nil payload should drop the event", msg, err)
+	}
+	if data := f.Format(scriptEvent()); !strings.Contains(string(data), `"count":3`) {
+		t.Fatal("Unexpected payload", string(data))
+	}
+}
+
+func TestScriptInvalid(t *testing.T) {
+	logger = zap.NewNop()
+
+	sources := []string{
+		"",
+		"function transform(event",
+		"local x = 1",
+		"error('failed')",
+		"while true do end",
+	}
+	for _, source := range sources {
+		if _, err := newScriptFormater(scriptRegistration(source)); err == nil {
+			t.Fatal("Script should be rejected", source)
+		}
+	}
+
+	reg := scriptRegistration("function transform(event) return '' end")
+	reg.Script.Language = "javascript"
+	if _, err := newScriptFormater(reg); err == nil {
+		t.Fatal("Unknown language should be rejected")
+	}
+}
+
+func TestScriptSandbox(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newScriptFormater(scriptRegistration(`
+function transform(event)
+	return tostring(io) .. tostring(os) .. tostring(load) .. tostring(require) .. tostring(dofile)
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := string(f.Format(scriptEvent())); data != "nilnilnilnilnil" {
+		t.Fatal("Libraries should not be available", data)
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newScriptFormater(scriptRegistration(`
+function transform(event)
+	if event.device == "loop" then
+		while true do end
+	end
+	if event.device == "deep" then
+		local function f(n) return f(n + 1) + 1 end
+		return f(1)
+	end
+	if event.device == "big" then
+		return string.rep("x", 2 * 1024 * 1024)
+	end
+	if event.device == "type" then
+		return {}
+	end
+	return "ok"
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf := f.(MessageFormater)
+
+	for _, device := range []string{"loop", "deep", "big", "type"} {
+		if _, err := mf.FormatMessage(&export.Event{Device: device}); err == nil {
+			t.Fatal("Script should fail", device)
+		}
+		// The state is rebuilt after a failure
+		if msg, err := mf.FormatMessage(scriptEvent()); err != nil || string(msg.Data) != "ok" {
+			t.Fatal("Script should recover", device, string(msg.Data), err)
+		}
+	}
+
+	if _, err := mf.FormatMessage(&export.Event{Device: "loop"}); !strings.Contains(err.Error(), "timed out") {
+		t.Fatal("Expected timeout", err)
+	}
+}
+
+func TestScriptJSON(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newScriptFormater(scriptRegistration(`
+function transform(event)
+	if event.device == "cycle" then
+		local t = {}; t.self = t; return json.encode(t)
+	end
+	if event.device == "list" then
+		local t = {}; t[1] = {t}; return json.encode(t)
+	end
+	if event.device == "deep" then
+		local t = {}
+		for i = 1, 1000 do t = {t} end
+		return json.encode(t)
+	end
+	local shared = {1, 2}
+	return json.encode({a = shared, b = shared})
+end
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf := f.(MessageFormater)
+
+	cases := map[string]string{
+		"cycle": "json.encode: cyclic table",
+		"list":  "json.encode: cyclic table",
+		"deep":  "json.encode: table nested too deeply",
+	}
+	for device, expected := range cases {
+		_, err := mf.FormatMessage(&export.Event{Device: device})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatal("Script should fail", device, err)
+		}
+	}
+
+	// Tables referenced twice are not cyclic
+	msg, err := mf.FormatMessage(scriptEvent())
+	if err != nil || string(msg.Data) != `{"a":[1,2],"b":[1,2]}` {
+		t.Fatal("Unexpected payload", string(msg.Data), err)
+	}
+}
+
+func TestScriptMemory(t *testing.T) {
+	logger = zap.NewNop()
+
+	reg := scriptRegistration(`
+function transform(event)
+	local s = string.rep("x", 8 * 1024)
+	if event.device == "rep" then
+		return string.rep("x", 512 * 1024 * 1024)
+	end
+	if event.device == "gsub" then
+		return (s:gsub("", s))
+	end
+	if event.device == "json" then
+		local t = {}
+		for i = 1, 8 * 1024 do t[i] = s end
+		return json.encode(t)
+	end
+	if event.device == "concat" then
+		while true do s = s .. s end
+	end
+	if event.device == "table" then
+		local t = {}
+		while true do t[#t + 1] = {s} end
+	end
+	return "ok"
+end
+`)
+	reg.Script.Timeout = 5000
+	reg.Script.MemoryLimit = 32
+	f, err := newScriptFormater(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf := f.(MessageFormater)
+
+	// The library functions are checked before allocating their results,
+	// the other allocations are sampled
+	exact := "memory limit of 32 MB exceeded"
+	sampled := "stopped after distro allocated more than 32 MB during the call"
+	cases := []struct {
+		device   string
+		expected string
+	}{
+		{"rep", exact},
+		{"gsub", exact},
+		{"json", exact},
+		{"concat", sampled},
+		{"table", sampled},
+	}
+	for _, c := range cases {
+		_, err := mf.FormatMessage(&export.Event{Device: c.device})
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Fatal("Script should exceed the memory limit", c.device, err)
+		}
+		if msg, err := mf.FormatMessage(scriptEvent()); err != nil || string(msg.Data) != "ok" {
+			t.Fatal("Script should recover", c.device, string(msg.Data), err)
+		}
+	}
+
+	reg.Script.Source = `string.rep("x", 512 * 1024 * 1024)` + "\nfunction transform(event) end"
+	if _, err := newScriptFormater(reg); err == nil || !strings.Contains(err.Error(), "memory limit") {
+		t.Fatal("Script should exceed the memory limit when loaded", err)
+	}
+
+	// Reported in the status of the registration
+	reg.Script.Source = "function transform(event) return string.rep('x', 2 ^ 30) end"
+	reg.Compression = export.CompNone
+	reg.Encryption.Algo = export.EncNone
+	reg.Destination = export.DestMQTT
+	defer statusDeleted(reg.Name)
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.update(reg) {
+		t.Fatal("Registration should be valid")
+	}
+	sender := &messageSender{}
+	regInfo.sender = sender
+	regInfo.processEvent(scriptEvent())
+	s, ok := registrationStatus(reg.Name)
+	if !ok || len(sender.msgs) != 0 || s.Errors != 1 || !strings.Contains(s.LastError, exact) {
+		t.Fatal("Unexpected status", s)
+	}
+}
+
+type messageSender struct {
+	msgs []Message
+}
+
+func (s *messageSender) Send(data []byte) {
+	s.msgs = append(s.msgs, Message{Data: data})
+}
+
+func (s *messageSender) SendMessage(msg Message) {
+	s.msgs = append(s.msgs, msg)
+}
+
+func TestScriptPipeline(t *testing.T) {
+	logger = zap.NewNop()
+
+	reg := scriptRegistration(`
+function transform(event)
+	if event.device == "fail" then
+		error("bad event")
+	end
+	return event.device, "topic/" .. event.device
+end
+`)
+	reg.Compression = export.CompNone
+	reg.Encryption.Algo = export.EncNone
+	reg.Destination = export.DestMQTT
+	defer statusDeleted(reg.Name)
+
+	regInfo := newRegistrationInfo()
+	if !regInfo.update(reg) {
+		t.Fatal("Registration should be valid")
+	}
+	sender := &messageSender{}
+	regInfo.sender = sender
+
+	regInfo.processEvent(scriptEvent())
+	regInfo.processEvent(&export.Event{Device: "fail"})
+	if len(sender.msgs) != 1 || string(sender.msgs[0].Data) != "dev1" || sender.msgs[0].Topic != "topic/dev1" {
+		t.Fatal("Unexpected messages", sender.msgs)
+	}
+
+	s, ok := registrationStatus(reg.Name)
+	if !ok || !s.Running || s.Sent != 1 || s.Errors != 1 || !strings.Contains(s.LastError, "bad event") {
+		t.Fatal("Unexpected status", s)
+	}
+
+	reg.Script.Source = "function transform("
+	if regInfo.update(reg) {
+		t.Fatal("Script should not compile")
+	}
+	if s, _ = registrationStatus(reg.Name); s.Running || s.Error == "" || s.Sent != 1 {
+		t.Fatal("Unexpected status", s)
+	}
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/drasko/edgex-export"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+const (
+	mimeTypeSenMLJSON = "application/senml+json"
+	mimeTypeSenMLCBOR = "application/senml+cbor"
+)
+
+// SenML labels of the CBOR representation (RFC 8428 section 6)
+const (
+	senmlBaseName = -2
+	senmlBaseTime = -3
+	senmlName     = 0
+	senmlUnit     = 1
+	senmlValue    = 2
+	senmlString   = 3
+	senmlBool     = 4
+	senmlTime     = 6
+)
+
+// senmlRecord - SenML record of a reading. The first record of a pack also
+// carries the base name and time of the event
+type senmlRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+}
+
+// cborMap - record with the integer labels of the CBOR representation
+func (r senmlRecord) cborMap() map[int]interface{} {
+	m := make(map[int]interface{})
+	if r.BaseName != "" {
+		m[senmlBaseName] = r.BaseName
+	}
+	if r.BaseTime != 0 {
+		m[senmlBaseTime] = r.BaseTime
+	}
+	if r.Name != "" {
+		m[senmlName] = r.Name
+	}
+	if r.Unit != "" {
+		m[senmlUnit] = r.Unit
+	}
+	if r.Value != nil {
+		m[senmlValue] = *r.Value
+	}
+	if r.StringValue != nil {
+		m[senmlString] = *r.StringValue
+	}
+	if r.BoolValue != nil {
+		m[senmlBool] = *r.BoolValue
+	}
+	if r.Time != 0 {
+		m[senmlTime] = r.Time
+	}
+	return m
+}
+
+// senmlSeconds - SenML time, in seconds, of a time in ms
+func senmlSeconds(ms int64) float64 {
+	return float64(ms) / 1000
+}
+
+// setSenMLValue - set the value of r from a reading value: a number, a
+// boolean ("true" or "false") or else a string
+func setSenMLValue(r *senmlRecord, value string) {
+	if v, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		r.Value = &v
+		return
+	}
+	if value == "true" || value == "false" {
+		b := value == "true"
+		r.BoolValue = &b
+		return
+	}
+	r.StringValue = &value
+}
+
+// senmlRecords - SenML pack of an event. The device is the base name, so
+// the full name of each record is "<device>:<reading>", and the origin of
+// the event the base time. Readings with another origin have their time
+// relative to it
+func senmlRecords(event *export.Event, units map[string]string) []senmlRecord {
+	records := make([]senmlRecord, 0, len(event.Readings))
+	for i, reading := range event.Readings {
+		r := senmlRecord{
+			Name: reading.Name,
+			Unit: units[reading.Name],
+		}
+		if i == 0 {
+			if event.Device != "" {
+				r.BaseName = event.Device + ":"
+			}
+			r.BaseTime = senmlSeconds(event.Origin)
+		}
+		if reading.Origin != 0 && reading.Origin != event.Origin {
+			r.Time = senmlSeconds(reading.Origin - event.Origin)
+		}
+		setSenMLValue(&r, reading.Value)
+		records = append(records, r)
+	}
+	return records
+}
+
+// senmlFormater - SenML JSON or CBOR format, with units by reading name
+type senmlFormater struct {
+	cbor  bool
+	units map[string]string
+}
+
+func newSenMLFormater(cbor bool) FormatFactory {
+	return func(reg export.Registration) (Formater, error) {
+		f := senmlFormater{cbor: cbor}
+		if reg.SenML != nil {
+			f.units = reg.SenML.Units
+		}
+		return f, nil
+	}
+}
+
+func (f senmlFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Error("Error generating SenML", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - SenML pack of the event, with the SenML content type
+func (f senmlFormater) FormatMessage(event *export.Event) (Message, error) {
+	records := senmlRecords(event, f.units)
+	if !f.cbor {
+		data, err := json.Marshal(records)
+		if err != nil {
+			return Message{}, err
+		}
+		return Message{Data: data, Headers: map[string]string{"Content-Type": mimeTypeSenMLJSON}}, nil
+	}
+
+	pack := make([]map[int]interface{}, len(records))
+	for i, r := range records {
+		pack[i] = r.cborMap()
+	}
+	var data []byte
+	h := &codec.CborHandle{}
+	h.Canonical = true
+	if err := codec.NewEncoderBytes(&data, h).Encode(pack); err != nil {
+		return Message{}, err
+	}
+	return Message{Data: data, Headers: map[string]string{"Content-Type": mimeTypeSenMLCBOR}}, nil
+}
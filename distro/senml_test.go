@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+func senmlEvent() *export.Event {
+	return &export.Event{
+		Device: "dev1",
+		Origin: 1500000000500,
+		Readings: []export.Reading{
+			{Name: "temperature", Value: "21.5", Origin: 1500000000500},
+			{Name: "open", Value: "true", Origin: 1500000001500},
+			{Name: "state", Value: "idle"},
+		},
+	}
+}
+
+func TestSenMLJSON(t *testing.T) {
+	logger = zap.NewNop()
+
+	reg := export.Registration{
+		Format: export.FormatSenMLJSON,
+		SenML:  &export.SenMLDetails{Units: map[string]string{"temperature": "Cel"}},
+	}
+	f, err := newFormater(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := f.(MessageFormater).FormatMessage(senmlEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"bn":"dev1:","bt":1500000000.5,"n":"temperature","u":"Cel","v":21.5},` +
+		`{"n":"open","vb":true,"t":1},{"n":"state","vs":"idle"}]`
+	if string(msg.Data) != expected || msg.Headers["Content-Type"] != mimeTypeSenMLJSON {
+		t.Fatal("Unexpected SenML", string(msg.Data), msg.Headers)
+	}
+
+	if data := f.Format(&export.Event{Device: "dev1"}); string(data) != "[]" {
+		t.Fatal("Event without readings should be empty", string(data))
+	}
+}
+
+func TestSenMLCBOR(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newFormater(export.Registration{Format: export.FormatSenMLCBOR})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := f.(MessageFormater).FormatMessage(senmlEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers["Content-Type"] != mimeTypeSenMLCBOR {
+		t.Fatal("Unexpected content type", msg.Headers)
+	}
+
+	var pack []map[int]interface{}
+	if err := codec.NewDecoderBytes(msg.Data, &codec.CborHandle{}).Decode(&pack); err != nil {
+		t.Fatal(err)
+	}
+	if len(pack) != 3 || pack[0][senmlBaseName] != "dev1:" || pack[0][senmlBaseTime] != 1500000000.5 ||
+		pack[0][senmlValue] != 21.5 || pack[0][senmlUnit] != nil ||
+		pack[1][senmlBool] != true || pack[1][senmlTime] != 1.0 || pack[2][senmlString] != "idle" {
+		t.Fatal("Unexpected SenML", pack)
+	}
+}
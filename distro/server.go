@@ -47,12 +47,18 @@ func replyNotifyRegistrations(w http.ResponseWriter, r *http.Request) {
 	}
 	if update.Operation != export.NotifyUpdateAdd &&
 		update.Operation != export.NotifyUpdateUpdate &&
-		update.Operation != export.NotifyUpdateDelete {
+		update.Operation != export.NotifyUpdateDelete &&
+		update.Operation != export.NotifyUpdateRename {
 		logger.Error("Invalid value for operation",
 			zap.String("operation", update.Operation))
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if update.Operation == export.NotifyUpdateRename && update.NewName == "" {
+		logger.Error("Missing new name for rename", zap.Any("update", update))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	RefreshRegistrations(update)
@@ -63,7 +69,13 @@ func httpServer() http.Handler {
 	mux := bone.New()
 
 	mux.Get("/api/v1/ping", http.HandlerFunc(replyPing))
+	mux.Get("/api/v1/capabilities", http.HandlerFunc(getCapabilities))
 	mux.Put("/api/v1/notify/registrations", http.HandlerFunc(replyNotifyRegistrations))
+	mux.Post("/api/v1/dryrun", http.HandlerFunc(dryRun))
+	mux.Post("/api/v1/test", http.HandlerFunc(testConnection))
+	mux.Get("/api/v1/status", http.HandlerFunc(getStatuses))
+	mux.Get("/api/v1/status/:name", http.HandlerFunc(getStatus))
+	mux.Get("/api/v1/schema/avro", http.HandlerFunc(getAvroSchema))
 
 	return mux
 }
@@ -0,0 +1,436 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+// Sparkplug B message types
+const (
+	sparkplugNBirth = "NBIRTH"
+	sparkplugNDeath = "NDEATH"
+	sparkplugNData  = "NDATA"
+	sparkplugDBirth = "DBIRTH"
+	sparkplugDDeath = "DDEATH"
+	sparkplugDData  = "DDATA"
+)
+
+// Fields of the Sparkplug B protobuf messages
+const (
+	// Payload
+	spPayloadTimestamp = 1
+	spPayloadMetric    = 2
+	spPayloadSeq       = 3
+	// Metric
+	spMetricName      = 1
+	spMetricTimestamp = 3
+	spMetricDatatype  = 4
+	spMetricLong      = 11
+	spMetricDouble    = 13
+	spMetricBoolean   = 14
+	spMetricString    = 15
+)
+
+// Sparkplug B metric data types
+const (
+	spTypeInt64   = 4
+	spTypeUInt64  = 8
+	spTypeDouble  = 10
+	spTypeBoolean = 11
+	spTypeString  = 12
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+const (
+	spBdSeqMetric   = "bdSeq"
+	spRebirthMetric = "Node Control/Rebirth"
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendKey(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendUintField(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendKey(b, field, wireVarint), v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendVarint(appendKey(b, field, wireBytes), uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendDoubleField(b []byte, field int, v float64) []byte {
+	b = appendKey(b, field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+// protoField - field of a protobuf message. Varint and fixed values are in
+// Value, length delimited ones in Data
+type protoField struct {
+	Number int
+	Wire   int
+	Value  uint64
+	Data   []byte
+}
+
+var errProtobuf = errors.New("invalid protobuf message")
+
+// parseProto - fields of a protobuf message, in order
+func parseProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errProtobuf
+		}
+		b = b[n:]
+		f := protoField{Number: int(key >> 3), Wire: int(key & 7)}
+
+		switch f.Wire {
+		case wireVarint:
+			if f.Value, n = binary.Uvarint(b); n <= 0 {
+				return nil, errProtobuf
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errProtobuf
+			}
+			f.Value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errProtobuf
+			}
+			f.Value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errProtobuf
+			}
+			f.Data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return nil, errProtobuf
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// sparkplugMetric - metric of a reading. Integers are Int64, other numbers
+// Double, "true" and "false" Boolean and anything else String
+func sparkplugMetric(name string, timestamp int64, value string) []byte {
+	m := appendBytesField(nil, spMetricName, []byte(name))
+	m = appendUintField(m, spMetricTimestamp, uint64(timestamp))
+
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+		m = appendUintField(m, spMetricDatatype, spTypeInt64)
+		return appendUintField(m, spMetricLong, uint64(v))
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		m = appendUintField(m, spMetricDatatype, spTypeDouble)
+		return appendDoubleField(m, spMetricDouble, v)
+	}
+	if value == "true" || value == "false" {
+		m = appendUintField(m, spMetricDatatype, spTypeBoolean)
+		var b uint64
+		if value == "true" {
+			b = 1
+		}
+		return appendUintField(m, spMetricBoolean, b)
+	}
+	m = appendUintField(m, spMetricDatatype, spTypeString)
+	return appendBytesField(m, spMetricString, []byte(value))
+}
+
+func sparkplugTopic(group, msgType, node, device string) string {
+	topic := export.SparkplugNamespace + "/" + group + "/" + msgType + "/" + node
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+// sparkplugFormater - Sparkplug B payload of the event, with a metric for
+// each reading, published as DDATA of the device (NDATA of the node for
+// events without device). The MQTT sender sets the sequence numbers
+type sparkplugFormater struct {
+	group string
+	node  string
+}
+
+func newSparkplugFormater(reg export.Registration) (Formater, error) {
+	if reg.Sparkplug == nil || reg.Sparkplug.GroupID == "" || reg.Sparkplug.NodeID == "" {
+		return nil, errors.New("group and node are required for " + export.FormatSparkplugB)
+	}
+	return sparkplugFormater{group: reg.Sparkplug.GroupID, node: reg.Sparkplug.NodeID}, nil
+}
+
+func (f sparkplugFormater) Format(event *export.Event) []byte {
+	msg, _ := f.FormatMessage(event)
+	return msg.Data
+}
+
+func (f sparkplugFormater) FormatMessage(event *export.Event) (Message, error) {
+	timestamp := event.Origin
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	payload := appendUintField(nil, spPayloadTimestamp, uint64(timestamp))
+	for _, r := range event.Readings {
+		origin := r.Origin
+		if origin == 0 {
+			origin = timestamp
+		}
+		payload = appendBytesField(payload, spPayloadMetric, sparkplugMetric(r.Name, origin, r.Value))
+	}
+
+	msgType := sparkplugDData
+	if event.Device == "" {
+		msgType = sparkplugNData
+	}
+	return Message{
+		Data:  payload,
+		Topic: sparkplugTopic(f.group, msgType, f.node, event.Device),
+	}, nil
+}
+
+// sparkplugDevice - last value of each metric of a device, in the order
+// they were first seen, for its birth certificates
+type sparkplugDevice struct {
+	names   []string
+	metrics map[string][]byte
+}
+
+// update - keep the metrics of payload. It returns true if one of them is
+// new, which needs a new birth certificate
+func (d *sparkplugDevice) update(payload []byte) (bool, error) {
+	fields, err := parseProto(payload)
+	if err != nil {
+		return false, err
+	}
+
+	added := false
+	for _, f := range fields {
+		if f.Number != spPayloadMetric || f.Wire != wireBytes {
+			continue
+		}
+		metric, err := parseProto(f.Data)
+		if err != nil {
+			return false, err
+		}
+		for _, mf := range metric {
+			if mf.Number == spMetricName && mf.Wire == wireBytes {
+				name := string(mf.Data)
+				if _, ok := d.metrics[name]; !ok {
+					d.names = append(d.names, name)
+					added = true
+				}
+				d.metrics[name] = append([]byte{}, f.Data...)
+			}
+		}
+	}
+	return added, nil
+}
+
+// birth - payload of the birth certificate, with every metric of the device
+func (d *sparkplugDevice) birth(timestamp uint64) []byte {
+	payload := appendUintField(nil, spPayloadTimestamp, timestamp)
+	for _, name := range d.names {
+		payload = appendBytesField(payload, spPayloadMetric, d.metrics[name])
+	}
+	return payload
+}
+
+// sparkplugSender - MQTT sender publishing as a Sparkplug B edge node.
+// Each connection is a session: the NDEATH of the session is the will of
+// the connection, and NBIRTH and the DBIRTH of the known devices are
+// published once connected. Devices get a DBIRTH when first seen, or when
+// they report a new metric. Messages but NDEATH carry the sequence number
+// of the session, appended to the payloads set by the format
+type sparkplugSender struct {
+	addr   export.Addressable
+	group  string
+	node   string
+	client MQTT.Client
+	// Sessions started, and bdSeq and sequence number of the current one
+	sessions uint64
+	bdSeq    uint64
+	seq      uint64
+	// Known devices, in the order they were first seen
+	devices map[string]*sparkplugDevice
+	order   []string
+	// Devices with a birth certificate in the current session
+	born map[string]bool
+}
+
+func newSparkplugSender(reg export.Registration) (Sender, error) {
+	if reg.Sparkplug == nil || reg.Sparkplug.GroupID == "" || reg.Sparkplug.NodeID == "" {
+		return nil, errors.New("group and node are required for " + export.FormatSparkplugB)
+	}
+	return &sparkplugSender{
+		addr:    reg.Addressable,
+		group:   reg.Sparkplug.GroupID,
+		node:    reg.Sparkplug.NodeID,
+		devices: make(map[string]*sparkplugDevice),
+	}, nil
+}
+
+func sparkplugNow() uint64 {
+	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+}
+
+// publish - publish payload with the next sequence number
+func (s *sparkplugSender) publish(msgType, device string, payload []byte) error {
+	payload = appendUintField(append([]byte{}, payload...), spPayloadSeq, s.seq)
+	s.seq = (s.seq + 1) % 256
+
+	token := s.client.Publish(sparkplugTopic(s.group, msgType, s.node, device), 0, false, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// nodeDeath - payload of the NDEATH of the session
+func (s *sparkplugSender) nodeDeath() []byte {
+	death := appendUintField(nil, spPayloadTimestamp, sparkplugNow())
+	return appendBytesField(death, spPayloadMetric, bdSeqMetric(s.bdSeq))
+}
+
+// connect - start a session, with a new bdSeq
+func (s *sparkplugSender) connect() error {
+	s.bdSeq = s.sessions % 256
+	s.sessions++
+	death := s.nodeDeath()
+
+	opts := mqttClientOptions(s.addr)
+	opts.SetBinaryWill(sparkplugTopic(s.group, sparkplugNDeath, s.node, ""), death, 1, false)
+	s.client = MQTT.NewClient(opts)
+	if token := s.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	s.seq = 0
+	s.born = make(map[string]bool)
+	rebirth := sparkplugMetric(spRebirthMetric, int64(sparkplugNow()), "false")
+	birth := appendUintField(nil, spPayloadTimestamp, sparkplugNow())
+	birth = appendBytesField(birth, spPayloadMetric, bdSeqMetric(s.bdSeq))
+	birth = appendBytesField(birth, spPayloadMetric, rebirth)
+	if err := s.publish(sparkplugNBirth, "", birth); err != nil {
+		return err
+	}
+
+	for _, device := range s.order {
+		if err := s.publish(sparkplugDBirth, device, s.devices[device].birth(sparkplugNow())); err != nil {
+			return err
+		}
+		s.born[device] = true
+	}
+	return nil
+}
+
+func bdSeqMetric(bdSeq uint64) []byte {
+	m := appendBytesField(nil, spMetricName, []byte(spBdSeqMetric))
+	m = appendUintField(m, spMetricTimestamp, sparkplugNow())
+	m = appendUintField(m, spMetricDatatype, spTypeUInt64)
+	return appendUintField(m, spMetricLong, bdSeq)
+}
+
+func (s *sparkplugSender) Send(data []byte) {
+	logger.Warn("Sparkplug message without topic, drop event")
+}
+
+// SendMessage - publish msg as DDATA or NDATA, after the birth certificates
+// it needs
+func (s *sparkplugSender) SendMessage(msg Message) {
+	parts := strings.Split(msg.Topic, "/")
+	if len(parts) < 4 {
+		logger.Warn("Invalid sparkplug topic, drop event", zap.String("topic", msg.Topic))
+		return
+	}
+	msgType, device := parts[2], strings.Join(parts[4:], "/")
+
+	if s.client == nil || !s.client.IsConnected() {
+		logger.Info("Connecting to mqtt server")
+		if err := s.connect(); err != nil {
+			logger.Warn("Could not start sparkplug session, drop event", zap.Error(err))
+			return
+		}
+	}
+
+	if msgType == sparkplugDData {
+		d, ok := s.devices[device]
+		if !ok {
+			d = &sparkplugDevice{metrics: make(map[string][]byte)}
+			s.devices[device] = d
+			s.order = append(s.order, device)
+		}
+		added, err := d.update(msg.Data)
+		if err != nil {
+			logger.Warn("Invalid sparkplug payload, drop event", zap.Error(err))
+			return
+		}
+		if added || !s.born[device] {
+			if err := s.publish(sparkplugDBirth, device, d.birth(sparkplugNow())); err != nil {
+				logger.Warn("mqtt error: ", zap.Error(err))
+				return
+			}
+			s.born[device] = true
+		}
+	}
+
+	if err := s.publish(msgType, device, msg.Data); err != nil {
+		logger.Warn("mqtt error: ", zap.Error(err))
+	}
+}
+
+// Close - end the session, publishing DDEATH for the devices and NDEATH
+func (s *sparkplugSender) Close() error {
+	if s.client == nil || !s.client.IsConnected() {
+		return nil
+	}
+	for _, device := range s.order {
+		if s.born[device] {
+			s.publish(sparkplugDDeath, device, appendUintField(nil, spPayloadTimestamp, sparkplugNow()))
+		}
+	}
+	token := s.client.Publish(sparkplugTopic(s.group, sparkplugNDeath, s.node, ""), 1, false, s.nodeDeath())
+	token.Wait()
+	s.client.Disconnect(250)
+	return token.Error()
+}
+
+// Test - test of the MQTT connection of the node
+func (s *sparkplugSender) Test(res *export.ConnectivityResult) {
+	NewMqttSender(s.addr).(*mqttSender).Test(res)
+}
@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"go.uber.org/zap"
+)
+
+// sparkplugPublish - message received by sparkplugBroker. Will is set for
+// the CONNECT of a session
+type sparkplugPublish struct {
+	topic   string
+	payload []byte
+	will    bool
+}
+
+// sparkplugBroker - broker accepting any number of connections, recording
+// the wills and the publishes. Closing conns drops the current connection
+func sparkplugBroker(t *testing.T) (net.Listener, chan sparkplugPublish, chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan sparkplugPublish, 100)
+	conns := make(chan net.Conn, 10)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				defer conn.Close()
+				for {
+					p, err := packets.ReadPacket(conn)
+					if err != nil {
+						return
+					}
+					switch p := p.(type) {
+					case *packets.ConnectPacket:
+						received <- sparkplugPublish{topic: p.WillTopic, payload: p.WillMessage, will: true}
+						ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+						ack.Write(conn)
+					case *packets.PublishPacket:
+						received <- sparkplugPublish{topic: p.TopicName, payload: p.Payload}
+						if p.Qos == 1 {
+							ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+							ack.MessageID = p.MessageID
+							ack.Write(conn)
+						}
+					case *packets.PingreqPacket:
+						packets.NewControlPacket(packets.Pingresp).Write(conn)
+					case *packets.DisconnectPacket:
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l, received, conns
+}
+
+// sparkplugPayload - decoded payload, with the metric values by name
+type sparkplugPayload struct {
+	timestamp uint64
+	seq       int
+	metrics   map[string]interface{}
+	types     map[string]uint64
+	names     []string
+}
+
+func decodeSparkplug(t *testing.T, data []byte) sparkplugPayload {
+	fields, err := parseProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := sparkplugPayload{seq: -1, metrics: make(map[string]interface{}), types: make(map[string]uint64)}
+	for _, f := range fields {
+		switch f.Number {
+		case spPayloadTimestamp:
+			p.timestamp = f.Value
+		case spPayloadSeq:
+			p.seq = int(f.Value)
+		case spPayloadMetric:
+			metric, err := parseProto(f.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var name string
+			var value interface{}
+			var datatype uint64
+			for _, mf := range metric {
+				switch mf.Number {
+				case spMetricName:
+					name = string(mf.Data)
+				case spMetricDatatype:
+					datatype = mf.Value
+				case spMetricLong:
+					value = int64(mf.Value)
+				case spMetricDouble:
+					value = math.Float64frombits(mf.Value)
+				case spMetricBoolean:
+					value = mf.Value == 1
+				case spMetricString:
+					value = string(mf.Data)
+				}
+			}
+			p.names = append(p.names, name)
+			p.metrics[name] = value
+			p.types[name] = datatype
+		}
+	}
+	return p
+}
+
+func sparkplugRegistration(l net.Listener) export.Registration {
+	reg := mqttRegistration(l)
+	reg.Name = "sparkplug"
+	reg.Format = export.FormatSparkplugB
+	reg.Addressable.Topic = ""
+	reg.Sparkplug = &export.SparkplugDetails{GroupID: "plant", NodeID: "gw1"}
+	return reg
+}
+
+func TestSparkplugFormat(t *testing.T) {
+	f, err := newSparkplugFormater(export.Registration{Sparkplug: &export.SparkplugDetails{GroupID: "plant", NodeID: "gw1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &export.Event{
+		Device: "dev1",
+		Origin: 1500000000500,
+		Readings: []export.Reading{
+			{Name: "count", Value: "-3"},
+			{Name: "temperature", Value: "21.5", Origin: 1500000000400},
+			{Name: "open", Value: "true"},
+			{Name: "state", Value: "idle"},
+		},
+	}
+	msg, _ := f.(MessageFormater).FormatMessage(event)
+	if msg.Topic != "spBv1.0/plant/DDATA/gw1/dev1" {
+		t.Fatal("Unexpected topic", msg.Topic)
+	}
+	p := decodeSparkplug(t, msg.Data)
+	if p.timestamp != 1500000000500 || p.seq != -1 || p.metrics["count"] != int64(-3) ||
+		p.metrics["temperature"] != 21.5 || p.metrics["open"] != true || p.metrics["state"] != "idle" ||
+		p.types["count"] != spTypeInt64 || p.types["temperature"] != spTypeDouble ||
+		p.types["open"] != spTypeBoolean || p.types["state"] != spTypeString {
+		t.Fatal("Unexpected payload", p)
+	}
+
+	msg, _ = f.(MessageFormater).FormatMessage(&export.Event{})
+	if msg.Topic != "spBv1.0/plant/NDATA/gw1" {
+		t.Fatal("Unexpected topic", msg.Topic)
+	}
+
+	if _, err := newSparkplugFormater(export.Registration{}); err == nil {
+		t.Fatal("Missing group and node should be rejected")
+	}
+}
+
+func TestSparkplugSender(t *testing.T) {
+	logger = zap.NewNop()
+
+	l, received, conns := sparkplugBroker(t)
+	defer l.Close()
+
+	reg := sparkplugRegistration(l)
+	if err := reg.ValidateWith(capabilities()); err != nil {
+		t.Fatal(err)
+	}
+	regInfo := newRegistrationInfo()
+	if !regInfo.update(reg) {
+		t.Fatal("Registration should be valid")
+	}
+	defer statusDeleted(reg.Name)
+
+	expect := func(topic string, seq int) sparkplugPayload {
+		select {
+		case m := <-received:
+			if m.topic != topic {
+				t.Fatal("Unexpected topic", m.topic, "expected", topic)
+			}
+			p := decodeSparkplug(t, m.payload)
+			if p.seq != seq {
+				t.Fatal("Unexpected sequence number", topic, p.seq, "expected", seq)
+			}
+			return p
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a message on", topic)
+		}
+		return sparkplugPayload{}
+	}
+	event := func(device string, readings ...export.Reading) *export.Event {
+		return &export.Event{Device: device, Origin: 1500000000000, Readings: readings}
+	}
+
+	regInfo.processEvent(event("dev1", export.Reading{Name: "temperature", Value: "21.5"}))
+	if p := expect("spBv1.0/plant/NDEATH/gw1", -1); p.metrics[spBdSeqMetric] != int64(0) {
+		t.Fatal("Unexpected will", p)
+	}
+	if p := expect("spBv1.0/plant/NBIRTH/gw1", 0); p.metrics[spBdSeqMetric] != int64(0) ||
+		p.metrics[spRebirthMetric] != false {
+		t.Fatal("Unexpected NBIRTH", p)
+	}
+	expect("spBv1.0/plant/DBIRTH/gw1/dev1", 1)
+	expect("spBv1.0/plant/DDATA/gw1/dev1", 2)
+
+	// Births are only published for new devices and metrics
+	regInfo.processEvent(event("dev1", export.Reading{Name: "temperature", Value: "22"}))
+	expect("spBv1.0/plant/DDATA/gw1/dev1", 3)
+	regInfo.processEvent(event("dev1", export.Reading{Name: "humidity", Value: "40"}))
+	if p := expect("spBv1.0/plant/DBIRTH/gw1/dev1", 4); len(p.names) != 2 || p.metrics["temperature"] != int64(22) {
+		t.Fatal("Birth should have every metric of the device", p)
+	}
+	expect("spBv1.0/plant/DDATA/gw1/dev1", 5)
+
+	// A new connection is a new session, with the births of known devices
+	conn := <-conns
+	conn.Close()
+	sender := regInfo.sender.(*sparkplugSender)
+	for i := 0; sender.client.IsConnected(); i++ {
+		if i == 100 {
+			t.Fatal("Client should be disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	regInfo.processEvent(event("dev2", export.Reading{Name: "open", Value: "false"}))
+	expect("spBv1.0/plant/NDEATH/gw1", -1)
+	if p := expect("spBv1.0/plant/NBIRTH/gw1", 0); p.metrics[spBdSeqMetric] != int64(1) {
+		t.Fatal("bdSeq should be incremented", p)
+	}
+	if p := expect("spBv1.0/plant/DBIRTH/gw1/dev1", 1); len(p.names) != 2 {
+		t.Fatal("Unexpected DBIRTH", p)
+	}
+	expect("spBv1.0/plant/DBIRTH/gw1/dev2", 2)
+	expect("spBv1.0/plant/DDATA/gw1/dev2", 3)
+
+	// Terminating the registration ends the session
+	go func() {
+		regInfo.chRegistration <- nil
+	}()
+	registrationLoop(regInfo)
+	expect("spBv1.0/plant/DDEATH/gw1/dev1", 4)
+	expect("spBv1.0/plant/DDEATH/gw1/dev2", 5)
+	if p := expect("spBv1.0/plant/NDEATH/gw1", -1); p.metrics[spBdSeqMetric] != int64(1) {
+		t.Fatal("Unexpected NDEATH", p)
+	}
+}
+
+func TestSparkplugValidation(t *testing.T) {
+	l, _, _ := sparkplugBroker(t)
+	defer l.Close()
+
+	reg := sparkplugRegistration(l)
+	if err := reg.ValidateWith(capabilities()); err != nil || reg.Addressable.Topic != "spBv1.0/plant" {
+		t.Fatal("Unexpected validation", err, reg.Addressable.Topic)
+	}
+
+	reg.Compression = export.CompGzip
+	reg.CloudEvents = &export.CloudEventsDetails{}
+	errs, ok := reg.ValidateWith(capabilities()).(export.ValidationError)
+	if !ok || len(errs) != 2 || errs[0].Field != "compression" || errs[1].Field != "cloudEvents" {
+		t.Fatal("Compression and CloudEvents should be rejected", errs)
+	}
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-zoo/bone"
+	"go.uber.org/zap"
+)
+
+// RegistrationStatus - state of the pipeline of a registration. Error is
+// why the pipeline is not running, LastError the last failure processing
+// an event, at LastErrorTime in ms
+type RegistrationStatus struct {
+	Name          string `json:"name"`
+	Running       bool   `json:"running"`
+	Error         string `json:"error,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	LastErrorTime int64  `json:"lastErrorTime,omitempty"`
+	Errors        uint64 `json:"errors"`
+	Sent          uint64 `json:"sent"`
+}
+
+var statuses = struct {
+	sync.Mutex
+	m map[string]*RegistrationStatus
+}{m: make(map[string]*RegistrationStatus)}
+
+// withStatus - run fn with the status of name, creating it if needed
+func withStatus(name string, fn func(s *RegistrationStatus)) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	s, ok := statuses.m[name]
+	if !ok {
+		s = &RegistrationStatus{Name: name}
+		statuses.m[name] = s
+	}
+	fn(s)
+}
+
+// statusUpdated - record the result of updating the pipeline of name. The
+// counters are kept across updates
+func statusUpdated(name string, err error) {
+	withStatus(name, func(s *RegistrationStatus) {
+		s.Running = err == nil
+		s.Error = ""
+		if err != nil {
+			s.Error = err.Error()
+		}
+	})
+}
+
+// statusEventFailed - record a failure processing an event
+func statusEventFailed(name string, err error) {
+	withStatus(name, func(s *RegistrationStatus) {
+		s.Errors++
+		s.LastError = err.Error()
+		s.LastErrorTime = time.Now().UnixNano() / int64(time.Millisecond)
+	})
+}
+
+func statusSent(name string) {
+	withStatus(name, func(s *RegistrationStatus) {
+		s.Sent++
+	})
+}
+
+func statusDeleted(name string) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	delete(statuses.m, name)
+}
+
+func registrationStatus(name string) (RegistrationStatus, bool) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	s, ok := statuses.m[name]
+	if !ok {
+		return RegistrationStatus{}, false
+	}
+	return *s, true
+}
+
+// allStatuses - statuses sorted by name
+func allStatuses() []RegistrationStatus {
+	statuses.Lock()
+	defer statuses.Unlock()
+	res := make([]RegistrationStatus, 0, len(statuses.m))
+	for _, s := range statuses.m {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func replyStatus(w http.ResponseWriter, v interface{}) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to generate json", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
+
+// getStatuses - status of every registration distro knows of
+func getStatuses(w http.ResponseWriter, r *http.Request) {
+	replyStatus(w, allStatuses())
+}
+
+// getStatus - status of a registration by name
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	name := bone.GetValue(r, "name")
+	s, ok := registrationStatus(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "Registration not found: "+name)
+		return
+	}
+	replyStatus(w, s)
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetStatus(t *testing.T) {
+	statusUpdated("status1", nil)
+	statusSent("status1")
+	statusUpdated("status2", errors.New("failed"))
+	defer statusDeleted("status1")
+	defer statusDeleted("status2")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		httpServer().ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/api/v1/status/status1")
+	s := RegistrationStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !s.Running || s.Sent != 1 {
+		t.Fatal("Unexpected status", w.Code, s)
+	}
+
+	w = get("/api/v1/status")
+	list := []RegistrationStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	// Other tests may leave statuses of their own
+	var found *RegistrationStatus
+	for i := range list {
+		if list[i].Name == "status2" {
+			found = &list[i]
+		}
+	}
+	if found == nil || found.Running || found.Error != "failed" {
+		t.Fatal("Unexpected statuses", list)
+	}
+
+	if w = get("/api/v1/status/unknown"); w.Code != http.StatusNotFound {
+		t.Fatal("Unknown registration should not be found", w.Code)
+	}
+}
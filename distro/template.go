@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+// templateFormater - format executing a text/template with each event
+type templateFormater struct {
+	tmpl        *template.Template
+	contentType string
+}
+
+// newTemplateFormater - parse the template of reg once for all its events
+func newTemplateFormater(reg export.Registration) (Formater, error) {
+	if reg.Template == nil || reg.Template.Source == "" {
+		return nil, errors.New("template is required for " + export.FormatTemplate)
+	}
+	tmpl, err := export.ParseTemplate(reg.Template.Source)
+	if err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	return templateFormater{tmpl: tmpl, contentType: reg.Template.ContentType}, nil
+}
+
+func (f templateFormater) Format(event *export.Event) []byte {
+	msg, err := f.FormatMessage(event)
+	if err != nil {
+		logger.Warn("Template failed", zap.Error(err))
+		return nil
+	}
+	return msg.Data
+}
+
+// FormatMessage - execute the template, setting the Content-Type header if
+// the registration has a content type
+func (f templateFormater) FormatMessage(event *export.Event) (Message, error) {
+	msg := Message{}
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, event); err != nil {
+		return msg, fmt.Errorf("template: %v", err)
+	}
+	msg.Data = buf.Bytes()
+	if f.contentType != "" {
+		msg.Headers = map[string]string{"Content-Type": f.contentType}
+	}
+	return msg, nil
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"testing"
+
+	"github.com/drasko/edgex-export"
+	"go.uber.org/zap"
+)
+
+func templateRegistration(source, contentType string) export.Registration {
+	return export.Registration{
+		Name:     "template",
+		Format:   export.FormatTemplate,
+		Template: &export.TemplateDetails{Source: source, ContentType: contentType},
+	}
+}
+
+func TestTemplateFormat(t *testing.T) {
+	logger = zap.NewNop()
+
+	f, err := newTemplateFormater(templateRegistration(
+		`{{.Device}},{{formatTime .Origin}},{{formatTime .Origin "2006-01-02"}},`+
+			`{{with reading . "temperature"}}{{printf "%.1f" (parseFloat .Value)}}{{end}},`+
+			`{{with reading . "missing"}}found{{end}},{{toJSON (index .Readings 1).Name}}`,
+		"text/csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := scriptEvent()
+	event.Origin = 1500000000123
+	msg, err := f.(MessageFormater).FormatMessage(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `dev1,2017-07-14T02:40:00.123Z,2017-07-14,21.5,,"humidity"`
+	if string(msg.Data) != expected || msg.Headers["Content-Type"] != "text/csv" {
+		t.Fatal("Unexpected message", string(msg.Data), msg.Headers)
+	}
+
+	// Execution errors are reported, as values that are not numbers
+	event.Readings[0].Value = "warm"
+	if _, err := f.(MessageFormater).FormatMessage(event); err == nil {
+		t.Fatal("Invalid number should fail")
+	}
+	if data := f.Format(event); data != nil {
+		t.Fatal("Failed template should not format", string(data))
+	}
+
+	f, _ = newTemplateFormater(templateRegistration(`{{.Device}}`, ""))
+	if msg, _ := f.(MessageFormater).FormatMessage(event); string(msg.Data) != "dev1" || msg.Headers != nil {
+		t.Fatal("Default content type should be kept", msg.Headers)
+	}
+
+	for _, source := range []string{"", "{{.Device", "{{unknown}}"} {
+		if _, err := newTemplateFormater(templateRegistration(source, "")); err == nil {
+			t.Fatal("Template should be rejected", source)
+		}
+	}
+}
@@ -9,6 +9,8 @@
 package distro
 
 import (
+	"time"
+
 	"github.com/drasko/edgex-export"
 )
 
@@ -23,11 +25,47 @@ type Sender interface {
 	Send(data []byte)
 }
 
+// Message - payload with the topic and headers to send it with. Empty
+// Topic and Headers keep the ones of the registration
+type Message struct {
+	Data    []byte
+	Topic   string
+	Headers map[string]string
+}
+
+// MessageSender - senders able to send a payload with its own topic or
+// headers
+type MessageSender interface {
+	SendMessage(msg Message)
+}
+
+// Tester - senders able to test the connection with their destination. The
+// steps of the test are added to res, and Cause and Error set if one fails
+type Tester interface {
+	Test(res *export.ConnectivityResult)
+}
+
 // Formater - Format interface
 type Formater interface {
 	Format(event *export.Event) []byte
 }
 
+// MessageFormater - formats setting the topic or headers of each payload.
+// A nil Data drops the event
+type MessageFormater interface {
+	FormatMessage(event *export.Event) (Message, error)
+}
+
+// BatchFormater - formats writing batches of events in each payload.
+// FormatMessage returns a nil Data until the batch is full, and Flush the
+// payload of the pending events, which wait at most Interval
+type BatchFormater interface {
+	MessageFormater
+	Pending() int
+	Flush() (Message, error)
+	Interval() time.Duration
+}
+
 // Transformer - Transform interface
 type Transformer interface {
 	Transform(data []byte) []byte
@@ -46,6 +84,8 @@ type registrationInfo struct {
 	encrypt      Transformer
 	sender       Sender
 	filter       []Filterer
+	// Error of the last failed update
+	err error
 
 	chRegistration chan *export.Registration
 	chEvent        chan *export.Event
@@ -57,6 +97,11 @@ type Config struct {
 	Port       int
 	ClientHost string
 	DataHost   string
+	// API key sent to the client, if it requires authentication
+	ClientAPIKey string
+	// Standalone mode, registrations are read from the files of this
+	// directory instead of the client
+	RegistrationDir string
 }
 
 var cfg Config
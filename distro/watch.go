@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2017
+// Cavium
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/drasko/edgex-export/files"
+	"go.uber.org/zap"
+)
+
+const (
+	// Seconds the client holds a watch request without changes
+	watchTimeout = 30
+	watchRetry   = time.Second
+)
+
+var errWatchGone = errors.New("watch token can not be resumed")
+
+var registrationResync = make(chan []export.Registration)
+
+func getWatchURL(host string) string {
+	return getRegistrationBaseURL(host) + "/watch"
+}
+
+// watchRegistrationsURL - long poll the client for changes after token. An
+// empty token returns the current token without waiting
+func watchRegistrationsURL(watchURL, token string) (*export.RegistrationChanges, error) {
+	query := url.Values{}
+	if token != "" {
+		query.Set("token", token)
+		query.Set("timeout", strconv.Itoa(watchTimeout))
+	}
+
+	client := &http.Client{Timeout: 2 * watchTimeout * time.Second}
+	response, err := clientGet(client, watchURL+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return nil, errWatchGone
+	default:
+		return nil, errors.New("unexpected watch status: " + response.Status)
+	}
+
+	changes := export.RegistrationChanges{}
+	if err := json.NewDecoder(response.Body).Decode(&changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+// syncRegistrations - get a watch token and then all registrations. Changes
+// made between both requests will be replayed by the watch, so they are
+// handled twice but never missed
+func syncRegistrations() (string, []export.Registration) {
+	changes, err := watchRegistrationsURL(getWatchURL(cfg.ClientHost), "")
+	if err != nil {
+		logger.Warn("Error getting watch token", zap.Error(err))
+		return "", nil
+	}
+	return changes.Token, getRegistrations()
+}
+
+// watchRegistrations - forward registration changes to the distro loop
+// until done is closed. It resyncs all registrations when the client can not
+// resume from the last token, for instance after a client restart
+func watchRegistrations(token string, done chan struct{}) {
+	watchURL := getWatchURL(cfg.ClientHost)
+	for {
+		changes, err := watchRegistrationsURL(watchURL, token)
+
+		switch {
+		case err == errWatchGone:
+			logger.Info("Watch token expired, resyncing registrations")
+			newToken, regs := syncRegistrations()
+			if regs == nil {
+				break
+			}
+			select {
+			case registrationResync <- regs:
+				token = newToken
+				continue
+			case <-done:
+				return
+			}
+		case err != nil:
+			logger.Warn("Error watching registrations", zap.Error(err))
+		default:
+			token = changes.Token
+			for _, update := range changes.Changes {
+				select {
+				case registrationChanges <- update:
+				case <-done:
+					return
+				}
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(watchRetry):
+		case <-done:
+			return
+		}
+	}
+}
+
+// watchRegistrationDir - resync the registrations with the files in dir
+// every time they change, until done is closed
+func watchRegistrationDir(dir string, done chan struct{}) {
+	logger.Info("Standalone mode, watching registration files", zap.String("dir", dir))
+	files.Watch(dir, capabilities, files.DefaultInterval, done, func(regs []export.Registration, err error) {
+		if err != nil {
+			logger.Error("Failed to load registration files", zap.String("dir", dir), zap.Error(err))
+			return
+		}
+		select {
+		case registrationResync <- regs:
+		case <-done:
+		}
+	})
+}
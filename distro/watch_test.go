@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2017 Cavium
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestWatchRegistrations(t *testing.T) {
+	logger = zap.NewNop()
+	defer logger.Sync()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("token") {
+		case "":
+			fmt.Fprint(w, `{"token":"a-0","changes":[]}`)
+		case "a-0":
+			fmt.Fprint(w, `{"token":"a-1","changes":[{"name":"reg","operation":"add"}]}`)
+		default:
+			w.WriteHeader(http.StatusGone)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	changes, err := watchRegistrationsURL(ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Token != "a-0" || len(changes.Changes) != 0 {
+		t.Fatal("Unexpected changes", changes)
+	}
+
+	changes, err = watchRegistrationsURL(ts.URL, changes.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Token != "a-1" || len(changes.Changes) != 1 ||
+		changes.Changes[0].Name != "reg" {
+		t.Fatal("Unexpected changes", changes)
+	}
+
+	if _, err := watchRegistrationsURL(ts.URL, "b-7"); err != errWatchGone {
+		t.Fatal("Expected gone error got", err)
+	}
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package distro
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drasko/edgex-export"
+)
+
+// xmlDocument - generic element, to check the structure of the documents
+type xmlDocument struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr    `xml:",any,attr"`
+	Children []xmlDocument `xml:",any"`
+	Text     string        `xml:",chardata"`
+}
+
+func (d xmlDocument) attr(name string) string {
+	for _, a := range d.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (d xmlDocument) child(name string) *xmlDocument {
+	for i := range d.Children {
+		if d.Children[i].XMLName.Local == name {
+			return &d.Children[i]
+		}
+	}
+	return nil
+}
+
+func xmlEvent() *export.Event {
+	event := formatEvent()
+	event.Readings[1].Value = `<"&'>`
+	return event
+}
+
+func TestXMLFormat(t *testing.T) {
+	f, err := newFormater(export.Registration{Format: export.FormatXML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := f.(MessageFormater).FormatMessage(xmlEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Headers["Content-Type"] != mimeTypeXML || !bytes.HasPrefix(msg.Data, []byte(xml.Header)) {
+		t.Fatal("Unexpected document", msg.Headers, string(msg.Data))
+	}
+
+	doc := xmlDocument{}
+	if err := xml.Unmarshal(msg.Data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.XMLName.Space != export.XMLDefaultNamespace || doc.XMLName.Local != export.XMLDefaultRoot ||
+		doc.attr("id") != "ev1" || doc.attr("device") != "dev1" || doc.attr("origin") != "1500000000400" ||
+		len(doc.Children) != 2 {
+		t.Fatal("Unexpected event", doc)
+	}
+	reading := doc.Children[1]
+	if reading.XMLName.Local != export.XMLReadingElement || reading.XMLName.Space != export.XMLDefaultNamespace ||
+		reading.child("value").Text != `<"&'>` || reading.child("id") != nil || reading.child("origin").Text != "0" {
+		t.Fatal("Unexpected reading", reading)
+	}
+
+	f, _ = newFormater(export.Registration{Format: export.FormatXML, XML: &export.XMLDetails{
+		Root: "Data", Namespace: "http://example.com/export", Prefix: "ex", Readings: export.XMLReadingsAttributes}})
+	data := f.Format(xmlEvent())
+	if !bytes.Contains(data, []byte(`<ex:Data xmlns:ex="http://example.com/export" id="ev1"`)) {
+		t.Fatal("Unexpected root", string(data))
+	}
+	doc = xmlDocument{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	reading = doc.Children[0]
+	if doc.XMLName.Space != "http://example.com/export" || reading.XMLName.Space != "http://example.com/export" ||
+		reading.attr("name") != "temperature" || reading.attr("value") != "21.5" || len(reading.Children) != 0 {
+		t.Fatal("Unexpected reading", reading)
+	}
+}
+
+// The documents validate against the published schema of their structure
+func TestXMLSchemaValidation(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is required to validate XML schemas")
+	}
+	dir, err := ioutil.TempDir("", "xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []*export.XMLDetails{
+		nil,
+		{Readings: export.XMLReadingsAttributes},
+		{Root: "Data", Namespace: "http://example.com/a&b", Prefix: "ex"},
+		{Root: "Data", Namespace: "urn:export", Prefix: "ex", Readings: export.XMLReadingsAttributes},
+	}
+	events := []*export.Event{xmlEvent(), {}, {Device: "dev1", Readings: []export.Reading{{}}}}
+	for i, c := range cases {
+		reg := export.Registration{Format: export.FormatXML, XML: c}
+		xsd, err := export.XMLSchema(reg.XMLOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := filepath.Join(dir, "schema.xsd")
+		ioutil.WriteFile(schema, xsd, 0600)
+
+		f, _ := newFormater(reg)
+		for _, event := range events {
+			document := filepath.Join(dir, "event.xml")
+			ioutil.WriteFile(document, f.Format(event), 0600)
+			if out, err := exec.Command(xmllint, "--noout", "--schema", schema, document).CombinedOutput(); err != nil {
+				t.Fatal("Document should be valid", i, err, string(out))
+			}
+		}
+
+		// Documents of another structure are rejected
+		other := export.Registration{Format: export.FormatXML, XML: cases[(i+1)%len(cases)]}
+		f, _ = newFormater(other)
+		document := filepath.Join(dir, "event.xml")
+		ioutil.WriteFile(document, f.Format(xmlEvent()), 0600)
+		out, err := exec.Command(xmllint, "--noout", "--schema", schema, document).CombinedOutput()
+		if err == nil || !strings.Contains(string(out), "fails to validate") {
+			t.Fatal("Document should be invalid", i, string(out))
+		}
+	}
+}
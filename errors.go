@@ -0,0 +1,21 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import "errors"
+
+// Registration repository errors
+var (
+	ErrNotFound      = errors.New("registration not found")
+	ErrDuplicateName = errors.New("registration name already taken")
+	ErrConflict      = errors.New("registration was modified concurrently")
+)
+
+// Registration history errors
+var (
+	ErrVersionNotFound = errors.New("registration version not found")
+)
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+// Package files reads registrations declared in a directory of YAML or JSON
+// files, for gateways managed by configuration management tools
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drasko/edgex-export"
+	"github.com/ghodss/yaml"
+)
+
+// DefaultInterval - time between two checks of the directory
+const DefaultInterval = 5 * time.Second
+
+var extensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// registrationFiles - files of dir with a known extension, sorted by name.
+// Hidden files are left out, as editors and tools use them for temporary
+// copies
+func registrationFiles(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []os.FileInfo{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") ||
+			!extensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// parse - registrations of a file, either a document with a registrations
+// list or a single registration
+func parse(data []byte) ([]export.Registration, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["registrations"]; ok {
+		doc := export.RegistrationDocument{}
+		err := json.Unmarshal(data, &doc)
+		return doc.Registrations, err
+	}
+
+	reg := export.Registration{}
+	err = json.Unmarshal(data, &reg)
+	return []export.Registration{reg}, err
+}
+
+// Load - read the registrations of the files in dir and validate them
+// against caps, marked as managed by their file. The fields set by the
+// client are cleared. Any invalid file or registration name used twice fails
+// the whole directory
+func Load(dir string, caps export.Capabilities) ([]export.Registration, error) {
+	infos, err := registrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	regs := []export.Registration{}
+	defined := make(map[string]string)
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		fileRegs, err := parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", info.Name(), err)
+		}
+
+		for i, reg := range fileRegs {
+			if err := reg.ValidateWith(caps); err != nil {
+				return nil, fmt.Errorf("%s: registration %d: %v", info.Name(), i, err)
+			}
+			if file, ok := defined[reg.Name]; ok {
+				return nil, errors.New(info.Name() + ": registration " + reg.Name +
+					" already defined in " + file)
+			}
+			defined[reg.Name] = info.Name()
+
+			reg.ID = ""
+			reg.Created = 0
+			reg.Modified = 0
+			reg.ManagedBy = export.ManagedByFile + info.Name()
+			regs = append(regs, reg)
+		}
+	}
+
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs, nil
+}
+
+// fingerprint - names, sizes and modification times of the files in dir,
+// which change when a file is edited, added or removed
+func fingerprint(dir string) string {
+	infos, err := registrationFiles(dir)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	parts := []string{}
+	for _, info := range infos {
+		parts = append(parts, info.Name(), strconv.FormatInt(info.Size(), 10),
+			strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Watch - call fn with the registrations of dir, and again every time its
+// files change, until done is closed. They are validated against the
+// capabilities returned by caps at each load. fn gets the error instead if
+// the directory can not be loaded, and is not called again until it changes
+func Watch(dir string, caps func() export.Capabilities, interval time.Duration,
+	done chan struct{}, fn func(regs []export.Registration, err error)) {
+
+	last := fingerprint(dir)
+	fn(Load(dir, caps()))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		current := fingerprint(dir)
+		if current == last {
+			continue
+		}
+		last = current
+		fn(Load(dir, caps()))
+	}
+}
@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drasko/edgex-export"
+)
+
+const (
+	singleReg = `
+name: single
+format: JSON
+destination: MQTT_TOPIC
+addressable:
+  Address: 127.0.0.1
+  Port: 1883
+  Topic: topic
+`
+	docRegs = `
+registrations:
+- name: doc2
+  format: XML
+  destination: REST_ENDPOINT
+  addressable:
+    Address: 127.0.0.1
+    Port: 5563
+    Method: POST
+- name: doc1
+  format: JSON
+  destination: REST_ENDPOINT
+  addressable:
+    Address: 127.0.0.1
+    Port: 5563
+    Method: POST
+`
+)
+
+func writeFile(t *testing.T, dir, name, data string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(regs []export.Registration) string {
+	list := []string{}
+	for _, reg := range regs {
+		list = append(list, reg.Name+"@"+reg.ManagedBy)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "a.yaml", singleReg)
+	writeFile(t, dir, "b.yml", docRegs)
+	writeFile(t, dir, "notes.txt", "ignored")
+	writeFile(t, dir, ".b.yml.swp", "ignored")
+
+	regs, err := Load(dir, export.DefaultCapabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(regs) != "doc1@file:b.yml,doc2@file:b.yml,single@file:a.yaml" {
+		t.Fatal("Unexpected registrations", names(regs))
+	}
+	if !regs[0].FileManaged() || regs[0].Compression != export.CompNone {
+		t.Fatal("Registrations should be validated and file managed", regs[0])
+	}
+
+	invalid := []string{
+		strings.Replace(singleReg, "single", "doc1", 1),
+		strings.Replace(singleReg, "JSON", "WRONG", 1),
+		"name: [",
+	}
+	for i, data := range invalid {
+		writeFile(t, dir, "c.json", data)
+		if _, err := Load(dir, export.DefaultCapabilities()); err == nil {
+			t.Errorf("case %d: expected error", i+1)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing"), export.DefaultCapabilities()); err == nil {
+		t.Fatal("Expected error for missing directory")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "a.yaml", singleReg)
+
+	loads := make(chan []export.Registration)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		Watch(dir, export.DefaultCapabilities, 10*time.Millisecond, done, func(regs []export.Registration, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			select {
+			case loads <- regs:
+			case <-done:
+			}
+		})
+		close(stopped)
+	}()
+	// Stop watching before the directory is removed
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	next := func() []export.Registration {
+		select {
+		case regs := <-loads:
+			return regs
+		case <-time.After(time.Second):
+			t.Fatal("Watch did not load the directory")
+			return nil
+		}
+	}
+
+	if regs := next(); names(regs) != "single@file:a.yaml" {
+		t.Fatal("Unexpected registrations", names(regs))
+	}
+
+	writeFile(t, dir, "b.yaml", docRegs)
+	if regs := next(); len(regs) != 3 {
+		t.Fatal("Unexpected registrations", names(regs))
+	}
+
+	os.Remove(filepath.Join(dir, "a.yaml"))
+	if regs := next(); names(regs) != "doc1@file:b.yaml,doc2@file:b.yaml" {
+		t.Fatal("Unexpected registrations", names(regs))
+	}
+}
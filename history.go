@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RegistrationVersion - stored change of a registration. Registration is
+// the registration after the change, or the deleted one for deletions
+type RegistrationVersion struct {
+	RegistrationID bson.ObjectId `bson:"registrationId" json:"registrationId"`
+	Version        int           `bson:"version" json:"version"`
+	Time           int64         `bson:"time" json:"time"`
+	User           string        `bson:"user" json:"user"`
+	Operation      string        `bson:"operation" json:"operation"`
+	Changes        []FieldChange `bson:"changes" json:"changes,omitempty"`
+	Registration   *Registration `bson:"registration" json:"registration,omitempty"`
+}
+
+// FieldChange - value of a registration field before and after a change.
+// Field is the JSON path of the field, as in "addressable.Address"
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old,omitempty" json:"old,omitempty"`
+	New   interface{} `bson:"new,omitempty" json:"new,omitempty"`
+}
+
+// Fields changed by every update, left out of the diffs
+var diffIgnored = map[string]bool{
+	"_id":      true,
+	"created":  true,
+	"modified": true,
+}
+
+func flatten(prefix string, v interface{}, fields map[string]interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		fields[prefix] = v
+		return
+	}
+	for k, child := range obj {
+		if prefix == "" && diffIgnored[k] {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flatten(path, child, fields)
+	}
+}
+
+func registrationFields(reg Registration) (map[string]interface{}, error) {
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	flatten("", v, fields)
+	return fields, nil
+}
+
+// DiffRegistrations - fields changed from old to new, sorted by field
+func DiffRegistrations(old, new Registration) ([]FieldChange, error) {
+	before, err := registrationFields(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := registrationFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	for field, v := range before {
+		if !reflect.DeepEqual(v, after[field]) {
+			changes = append(changes, FieldChange{Field: field, Old: v, New: after[field]})
+		}
+	}
+	for field, v := range after {
+		if _, ok := before[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, New: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
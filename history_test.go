@@ -0,0 +1,44 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRegistrations(t *testing.T) {
+	old := Registration{
+		Name:        "reg",
+		Modified:    1,
+		Format:      FormatJSON,
+		Addressable: Addressable{Address: "127.0.0.1", Port: 1883},
+	}
+	new := old
+	new.Modified = 2
+	new.Format = FormatXML
+	new.Addressable.Port = 8883
+	new.Labels = []string{"a"}
+
+	changes, err := DiffRegistrations(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FieldChange{
+		{Field: "addressable.Port", Old: 1883.0, New: 8883.0},
+		{Field: "format", Old: FormatJSON, New: FormatXML},
+		{Field: "labels", New: []interface{}{"a"}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatal("Unexpected changes", changes)
+	}
+
+	if changes, _ := DiffRegistrations(old, old); len(changes) != 0 {
+		t.Fatal("Expected no changes", changes)
+	}
+}
@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Measurements of the InfluxDB line protocol format
+const (
+	InfluxMeasurementReading = "reading"
+	InfluxMeasurementDevice  = "device"
+)
+
+// Timestamp precisions of the InfluxDB line protocol format
+const (
+	InfluxPrecisionNs = "ns"
+	InfluxPrecisionUs = "us"
+	InfluxPrecisionMs = "ms"
+	InfluxPrecisionS  = "s"
+)
+
+// Event and reading fields the InfluxDB tags can be set from
+const (
+	InfluxTagDevice        = "device"
+	InfluxTagEventID       = "id"
+	InfluxTagName          = "name"
+	InfluxTagReadingID     = "reading.id"
+	InfluxTagReadingDevice = "reading.device"
+)
+
+var influxTagSources = []string{InfluxTagDevice, InfluxTagEventID, InfluxTagName,
+	InfluxTagReadingID, InfluxTagReadingDevice}
+
+// InfluxDetails - options of the INFLUX_LINE format and the INFLUXDB
+// destination.
+//
+// Measurement is the reading name (the default, with a "value" field) or
+// the device (with a field named as the reading). Tags maps tag keys to the
+// event or reading field they are set from, and Precision is the precision
+// of the timestamps, ms by default. Bucket and Org are the destination of
+// the /api/v2/write requests, authenticated with the token set in
+// Addressable.Password
+type InfluxDetails struct {
+	Measurement string            `bson:"measurement,omitempty" json:"measurement,omitempty"`
+	Tags        map[string]string `bson:"tags,omitempty" json:"tags,omitempty"`
+	Precision   string            `bson:"precision,omitempty" json:"precision,omitempty"`
+	Bucket      string            `bson:"bucket,omitempty" json:"bucket,omitempty"`
+	Org         string            `bson:"org,omitempty" json:"org,omitempty"`
+}
@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Time formats of the mapped JSON events
+const (
+	MappingTimeMillis  = "ms"
+	MappingTimeRFC3339 = "rfc3339"
+)
+
+// MappingReadings - prefix of the mapping rules of the reading fields, as
+// in "readings.pushed"
+const MappingReadings = "readings."
+
+// JSONMapping - fields of the events of the JSON format. Include keeps only
+// the listed fields and Exclude drops the listed ones, then Rename renames
+// them. Rules of the reading fields are prefixed with "readings.", unless
+// the readings are flattened: Flatten sends each event as a single object
+// with the id, device and ts (the origin) of the event and a field for each
+// reading, named as the reading. TimeFormat sends the times, in ms by
+// default, as RFC 3339 strings, and TypedValues sends the reading values as
+// JSON numbers and booleans when they parse as such
+type JSONMapping struct {
+	Include     []string          `bson:"include,omitempty" json:"include,omitempty"`
+	Exclude     []string          `bson:"exclude,omitempty" json:"exclude,omitempty"`
+	Rename      map[string]string `bson:"rename,omitempty" json:"rename,omitempty"`
+	Flatten     bool              `bson:"flatten,omitempty" json:"flatten,omitempty"`
+	TimeFormat  string            `bson:"timeFormat,omitempty" json:"timeFormat,omitempty"`
+	TypedValues bool              `bson:"typedValues,omitempty" json:"typedValues,omitempty"`
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package memory
+
+import (
+	"sync"
+
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Repository - registrations and their history kept in memory, they are
+// lost on restart
+type Repository struct {
+	mutex         sync.RWMutex
+	registrations []export.Registration
+	versions      map[string][]export.RegistrationVersion
+}
+
+// NewRepository - create new memory repository
+func NewRepository() *Repository {
+	return &Repository{versions: make(map[string][]export.RegistrationVersion)}
+}
+
+func (r *Repository) index(match func(reg *export.Registration) bool) int {
+	for i := range r.registrations {
+		if match(&r.registrations[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func byID(id string) func(reg *export.Registration) bool {
+	return func(reg *export.Registration) bool {
+		return reg.ID.Hex() == id
+	}
+}
+
+func byName(name string) func(reg *export.Registration) bool {
+	return func(reg *export.Registration) bool {
+		return reg.Name == name
+	}
+}
+
+// Registrations - get registrations matching the query
+func (r *Repository) Registrations(q export.RegistrationQuery) ([]export.Registration, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	regs, total := q.Apply(r.registrations)
+	return regs, total, nil
+}
+
+func (r *Repository) registration(match func(reg *export.Registration) bool) (export.Registration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	i := r.index(match)
+	if i < 0 {
+		return export.Registration{}, export.ErrNotFound
+	}
+	return r.registrations[i], nil
+}
+
+// RegistrationByID - get registration by ID
+func (r *Repository) RegistrationByID(id string) (export.Registration, error) {
+	return r.registration(byID(id))
+}
+
+// RegistrationByName - get registration by name
+func (r *Repository) RegistrationByName(name string) (export.Registration, error) {
+	return r.registration(byName(name))
+}
+
+// AddRegistration - add a new registration
+func (r *Repository) AddRegistration(reg export.Registration) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.index(byName(reg.Name)) >= 0 {
+		return "", export.ErrDuplicateName
+	}
+
+	if reg.ID == "" {
+		reg.ID = bson.NewObjectId()
+	}
+	r.registrations = append(r.registrations, reg)
+	return reg.ID.Hex(), nil
+}
+
+// UpdateRegistration - replace the registration with the same ID, if its
+// modified value did not change
+func (r *Repository) UpdateRegistration(reg export.Registration, modified int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.index(byID(reg.ID.Hex()))
+	if i < 0 || reg.ID == "" {
+		return export.ErrNotFound
+	}
+	if r.registrations[i].Modified != modified {
+		return export.ErrConflict
+	}
+	if j := r.index(byName(reg.Name)); j >= 0 && j != i {
+		return export.ErrDuplicateName
+	}
+	r.registrations[i] = reg
+	return nil
+}
+
+func (r *Repository) delete(match func(reg *export.Registration) bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.index(match)
+	if i < 0 {
+		return export.ErrNotFound
+	}
+	r.registrations = append(r.registrations[:i], r.registrations[i+1:]...)
+	return nil
+}
+
+// DeleteRegistrationByID - delete registration by ID
+func (r *Repository) DeleteRegistrationByID(id string) error {
+	return r.delete(byID(id))
+}
+
+// DeleteRegistrationByName - delete registration by name
+func (r *Repository) DeleteRegistrationByName(name string) error {
+	return r.delete(byName(name))
+}
+
+// AddVersion - add the next version of a registration
+func (r *Repository) AddVersion(v export.RegistrationVersion) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id := v.RegistrationID.Hex()
+	v.Version = len(r.versions[id]) + 1
+	r.versions[id] = append(r.versions[id], copyVersion(v))
+	return v.Version, nil
+}
+
+// copyVersion - copy of v not sharing its registration, so the stored
+// versions are not changed through the returned ones
+func copyVersion(v export.RegistrationVersion) export.RegistrationVersion {
+	if v.Registration != nil {
+		reg := *v.Registration
+		v.Registration = &reg
+	}
+	return v
+}
+
+// Versions - get the versions of a registration
+func (r *Repository) Versions(id string) ([]export.RegistrationVersion, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	versions := make([]export.RegistrationVersion, len(r.versions[id]))
+	for i, v := range r.versions[id] {
+		versions[i] = copyVersion(v)
+	}
+	return versions, nil
+}
+
+// Version - get a version of a registration
+func (r *Repository) Version(id string, version int) (export.RegistrationVersion, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	versions := r.versions[id]
+	if version < 1 || version > len(versions) {
+		return export.RegistrationVersion{}, export.ErrVersionNotFound
+	}
+	return copyVersion(versions[version-1]), nil
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package mongo
+
+import (
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Attempts to insert a version when another one takes its number
+const versionRetries = 5
+
+var versionIndex = mgo.Index{
+	Key:    []string{"registrationId", "version"},
+	Unique: true,
+}
+
+// AddVersion - add the next version of a registration. The unique index
+// makes concurrent additions of the same version fail and retry
+func (r *Repository) AddVersion(v export.RegistrationVersion) (int, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(HistoryCollectionName)
+
+	if err := c.EnsureIndex(versionIndex); err != nil {
+		return 0, err
+	}
+
+	var err error
+	for i := 0; i < versionRetries; i++ {
+		last := export.RegistrationVersion{}
+		err = c.Find(bson.M{"registrationId": v.RegistrationID}).Sort("-version").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return 0, err
+		}
+
+		v.Version = last.Version + 1
+		if err = c.Insert(v); !mgo.IsDup(err) {
+			break
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return v.Version, nil
+}
+
+// Versions - get the versions of a registration
+func (r *Repository) Versions(id string) ([]export.RegistrationVersion, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(HistoryCollectionName)
+
+	versions := []export.RegistrationVersion{}
+	if !bson.IsObjectIdHex(id) {
+		return versions, nil
+	}
+	err := c.Find(bson.M{"registrationId": bson.ObjectIdHex(id)}).Sort("version").All(&versions)
+	return versions, err
+}
+
+// Version - get a version of a registration
+func (r *Repository) Version(id string, version int) (export.RegistrationVersion, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(HistoryCollectionName)
+
+	v := export.RegistrationVersion{}
+	if !bson.IsObjectIdHex(id) {
+		return v, export.ErrVersionNotFound
+	}
+	err := c.Find(bson.M{"registrationId": bson.ObjectIdHex(id), "version": version}).One(&v)
+	if err == mgo.ErrNotFound {
+		return v, export.ErrVersionNotFound
+	}
+	return v, err
+}
@@ -12,9 +12,11 @@ import (
 
 // DBName - DB name
 // CollectionName - Collection name
+// HistoryCollectionName - Collection of the registration versions
 const (
-	DBName         string = "coredata"
-	CollectionName string = "exportConfiguration"
+	DBName                string = "coredata"
+	CollectionName        string = "exportConfiguration"
+	HistoryCollectionName string = "exportHistory"
 )
 
 // Repository - get Mongo session
@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package mongo
+
+import (
+	"github.com/drasko/edgex-export"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func convertError(err error) error {
+	if err == mgo.ErrNotFound {
+		return export.ErrNotFound
+	}
+	return err
+}
+
+func queryFilter(q export.RegistrationQuery) bson.M {
+	filter := bson.M{}
+	if q.Destination != "" {
+		filter["destination"] = q.Destination
+	}
+	if q.Format != "" {
+		filter["format"] = q.Format
+	}
+	if q.Enabled != nil {
+		filter["enable"] = *q.Enabled
+	}
+	if q.Label != "" {
+		filter["labels"] = q.Label
+	}
+	return filter
+}
+
+// Registrations - get registrations matching the query
+func (r *Repository) Registrations(q export.RegistrationQuery) ([]export.Registration, int, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	query := c.Find(queryFilter(q))
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if q.Sort != "" {
+		query = query.Sort(q.Sort)
+	}
+	query = query.Skip(q.Offset)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	regs := []export.Registration{}
+	if err := query.All(&regs); err != nil {
+		return nil, 0, err
+	}
+	return regs, total, nil
+}
+
+// RegistrationByID - get registration by ID
+func (r *Repository) RegistrationByID(id string) (export.Registration, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	reg := export.Registration{}
+	if !bson.IsObjectIdHex(id) {
+		return reg, export.ErrNotFound
+	}
+	err := c.FindId(bson.ObjectIdHex(id)).One(&reg)
+	return reg, convertError(err)
+}
+
+// RegistrationByName - get registration by name
+func (r *Repository) RegistrationByName(name string) (export.Registration, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	reg := export.Registration{}
+	err := c.Find(bson.M{"name": name}).One(&reg)
+	return reg, convertError(err)
+}
+
+// AddRegistration - add a new registration
+func (r *Repository) AddRegistration(reg export.Registration) (string, error) {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	count, err := c.Find(bson.M{"name": reg.Name}).Count()
+	if err != nil {
+		return "", err
+	}
+	if count != 0 {
+		return "", export.ErrDuplicateName
+	}
+
+	if reg.ID == "" {
+		reg.ID = bson.NewObjectId()
+	}
+	if err := c.Insert(reg); err != nil {
+		return "", err
+	}
+	return reg.ID.Hex(), nil
+}
+
+// UpdateRegistration - replace the registration with the same ID, if its
+// modified value did not change
+func (r *Repository) UpdateRegistration(reg export.Registration, modified int64) error {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	query := bson.M{"name": reg.Name, "_id": bson.M{"$ne": reg.ID}}
+	count, err := c.Find(query).Count()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return export.ErrDuplicateName
+	}
+
+	err = c.Update(bson.M{"_id": reg.ID, "modified": modified}, reg)
+	if err != mgo.ErrNotFound {
+		return err
+	}
+
+	count, err = c.FindId(reg.ID).Count()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return export.ErrConflict
+	}
+	return export.ErrNotFound
+}
+
+// DeleteRegistrationByID - delete registration by ID
+func (r *Repository) DeleteRegistrationByID(id string) error {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	if !bson.IsObjectIdHex(id) {
+		return export.ErrNotFound
+	}
+	return convertError(c.RemoveId(bson.ObjectIdHex(id)))
+}
+
+// DeleteRegistrationByName - delete registration by name
+func (r *Repository) DeleteRegistrationByName(name string) error {
+	s := r.Session.Copy()
+	defer s.Close()
+	c := s.DB(DBName).C(CollectionName)
+
+	return convertError(c.Remove(bson.M{"name": name}))
+}
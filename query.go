@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import "sort"
+
+// Registration sort keys, prefixed with SortDescending to reverse the order
+const (
+	SortName       = "name"
+	SortCreated    = "created"
+	SortModified   = "modified"
+	SortDescending = "-"
+)
+
+// RegistrationQuery - Filters, order and page of a registration listing.
+// Empty fields do not filter and a zero Limit returns all registrations
+type RegistrationQuery struct {
+	Destination string
+	Format      string
+	Enabled     *bool
+	Label       string
+	Sort        string
+	Offset      int
+	Limit       int
+}
+
+// SortKey - sort key and order of the query
+func (q RegistrationQuery) SortKey() (key string, descending bool) {
+	if len(q.Sort) > 0 && q.Sort[:1] == SortDescending {
+		return q.Sort[1:], true
+	}
+	return q.Sort, false
+}
+
+// ValidSort - check that the query sorts by a known key
+func (q RegistrationQuery) ValidSort() bool {
+	key, _ := q.SortKey()
+	switch key {
+	case "", SortName, SortCreated, SortModified:
+		return true
+	}
+	return false
+}
+
+// Match - check if reg passes the query filters
+func (q RegistrationQuery) Match(reg *Registration) bool {
+	if q.Destination != "" && reg.Destination != q.Destination {
+		return false
+	}
+	if q.Format != "" && reg.Format != q.Format {
+		return false
+	}
+	if q.Enabled != nil && reg.Enable != *q.Enabled {
+		return false
+	}
+	if q.Label != "" {
+		for _, l := range reg.Labels {
+			if l == q.Label {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Apply - filter, sort and page regs. It returns the page and the number of
+// registrations passing the filters
+func (q RegistrationQuery) Apply(regs []Registration) ([]Registration, int) {
+	res := []Registration{}
+	for i := range regs {
+		if q.Match(&regs[i]) {
+			res = append(res, regs[i])
+		}
+	}
+
+	key, descending := q.SortKey()
+	less := func(i, j int) bool {
+		switch key {
+		case SortName:
+			return res[i].Name < res[j].Name
+		case SortCreated:
+			return res[i].Created < res[j].Created
+		case SortModified:
+			return res[i].Modified < res[j].Modified
+		}
+		return false
+	}
+	if descending {
+		sort.SliceStable(res, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(res, less)
+	}
+
+	total := len(res)
+	if q.Offset >= total {
+		return []Registration{}, total
+	}
+	res = res[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(res) {
+		res = res[:q.Limit]
+	}
+	return res, total
+}
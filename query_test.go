@@ -0,0 +1,53 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import "testing"
+
+func TestRegistrationQuery(t *testing.T) {
+	regs := []Registration{
+		{Name: "b", Created: 2, Modified: 5, Format: FormatJSON, Destination: DestMQTT, Enable: true, Labels: []string{"cloud"}},
+		{Name: "c", Created: 1, Modified: 6, Format: FormatXML, Destination: DestRest},
+		{Name: "a", Created: 3, Modified: 4, Format: FormatJSON, Destination: DestRest, Enable: true, Labels: []string{"cloud", "lab"}},
+	}
+	enabled := true
+
+	cases := []struct {
+		query RegistrationQuery
+		names string
+		total int
+	}{
+		{RegistrationQuery{}, "bca", 3},
+		{RegistrationQuery{Sort: SortName}, "abc", 3},
+		{RegistrationQuery{Sort: "-" + SortName}, "cba", 3},
+		{RegistrationQuery{Sort: SortCreated}, "cba", 3},
+		{RegistrationQuery{Sort: "-" + SortModified}, "cba", 3},
+		{RegistrationQuery{Format: FormatJSON}, "ba", 2},
+		{RegistrationQuery{Destination: DestRest}, "ca", 2},
+		{RegistrationQuery{Enabled: &enabled}, "ba", 2},
+		{RegistrationQuery{Label: "lab"}, "a", 1},
+		{RegistrationQuery{Label: "cloud", Sort: SortName}, "ab", 2},
+		{RegistrationQuery{Sort: SortName, Offset: 1}, "bc", 3},
+		{RegistrationQuery{Sort: SortName, Offset: 1, Limit: 1}, "b", 3},
+		{RegistrationQuery{Offset: 5}, "", 3},
+	}
+
+	for i, c := range cases {
+		res, total := c.query.Apply(regs)
+		names := ""
+		for _, reg := range res {
+			names += reg.Name
+		}
+		if names != c.names || total != c.total {
+			t.Errorf("case %d: expected %s (%d) got %s (%d)", i+1, c.names, c.total, names, total)
+		}
+	}
+
+	if (RegistrationQuery{Sort: "origin"}).ValidSort() {
+		t.Fatal("origin is not a valid sort key")
+	}
+}
@@ -7,6 +7,9 @@
 package export
 
 import (
+	"sort"
+	"strings"
+
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -25,6 +28,16 @@ const (
 	FormatIoTCoreJSON = "IOTCORE_JSON"
 	FormatAzureJSON   = "AZURE_JSON"
 	FormatCSV         = "CSV"
+	FormatScript      = "SCRIPT"
+	FormatTemplate    = "TEMPLATE"
+	FormatSenMLJSON   = "SENML_JSON"
+	FormatSenMLCBOR   = "SENML_CBOR"
+	FormatInfluxLine  = "INFLUX_LINE"
+	FormatSparkplugB  = "SPARKPLUG_B"
+	FormatMsgPack     = "MSGPACK"
+	FormatCBOR        = "CBOR"
+	FormatAvro        = "AVRO"
+	FormatAvroOCF     = "AVRO_OCF"
 )
 
 // Export destination types
@@ -34,6 +47,7 @@ const (
 	DestIotCoreMQTT = "IOTCORE_TOPIC"
 	DestAzureMQTT   = "AZURE_TOPIC"
 	DestRest        = "REST_ENDPOINT"
+	DestInfluxDB    = "INFLUXDB"
 )
 
 // Registration - Defines the registration details
@@ -51,56 +65,222 @@ type Registration struct {
 	Compression string            `json:"compression,omitempty"`
 	Enable      bool              `json:"enable"`
 	Destination string            `json:"destination,omitempty"`
+	Labels      []string          `json:"labels,omitempty"`
+	// Document structure of the XML format
+	XML *XMLDetails `json:"xml,omitempty"`
+	// Fields of the events of the JSON format
+	Mapping *JSONMapping `json:"mapping,omitempty"`
+	// Script turning events into payloads, for the SCRIPT format
+	Script *ScriptDetails `json:"script,omitempty"`
+	// Template of the payloads, for the TEMPLATE format
+	Template *TemplateDetails `json:"template,omitempty"`
+	// SenML records options, for the SENML_JSON and SENML_CBOR formats
+	SenML *SenMLDetails `json:"senml,omitempty"`
+	// Line protocol and write options, for the INFLUX_LINE format and the
+	// INFLUXDB destination
+	Influx *InfluxDetails `json:"influx,omitempty"`
+	// CloudEvents envelope of the payloads, of any format
+	CloudEvents *CloudEventsDetails `json:"cloudEvents,omitempty"`
+	// Edge node of the SPARKPLUG_B format
+	Sparkplug *SparkplugDetails `json:"sparkplug,omitempty"`
+	// Object container files options, for the AVRO_OCF format
+	Avro *AvroDetails `json:"avro,omitempty"`
+	// Source of registrations not managed through the API, as in
+	// "file:gateway.yaml"
+	ManagedBy string `json:"managedBy,omitempty"`
+}
+
+// ManagedByFile - ManagedBy prefix of the registrations read from a file
+const ManagedByFile = "file:"
+
+// FileManaged - check if the registration is read from a file, and so read
+// only through the API
+func (reg *Registration) FileManaged() bool {
+	return strings.HasPrefix(reg.ManagedBy, ManagedByFile)
 }
 
 const (
 	NotifyUpdateAdd    = "add"
 	NotifyUpdateUpdate = "update"
 	NotifyUpdateDelete = "delete"
+	NotifyUpdateRename = "rename"
 )
 
+// NotifyUpdate - Registration change. Renames carry the previous name in
+// Name and the new one in NewName
 type NotifyUpdate struct {
 	Name      string `json:"name"`
+	NewName   string `json:"newName,omitempty"`
 	Operation string `json:"operation"`
 }
 
-func (reg *Registration) Validate() bool {
+// RegistrationChanges - Changes returned by the client watch endpoint.
+// Token must be sent back to resume watching after the last change
+type RegistrationChanges struct {
+	Token   string         `json:"token"`
+	Changes []NotifyUpdate `json:"changes"`
+}
+
+// RegistrationDocument - Registrations exported or imported in bulk, as
+// JSON or YAML
+type RegistrationDocument struct {
+	Registrations []Registration `json:"registrations"`
+}
+
+// Validate - check the registration fields against DefaultCapabilities,
+// setting the defaults of the optional ones. It returns a ValidationError
+// listing every invalid field
+func (reg *Registration) Validate() error {
+	return reg.ValidateWith(DefaultCapabilities())
+}
+
+// ValidateWith - Validate against the capabilities of a distro, so
+// registrations it would not export are rejected
+func (reg *Registration) ValidateWith(caps Capabilities) error {
+	var errs ValidationError
+
+	if reg.Name == "" {
+		errs.add("name", CodeRequired, "name is required")
+	}
 
 	if reg.Compression == "" {
 		reg.Compression = CompNone
 	}
+	if reg.Encryption.Algo == "" {
+		reg.Encryption.Algo = EncNone
+	}
+	if reg.Script != nil && reg.Script.Language == "" {
+		reg.Script.Language = ScriptLua
+	}
+	if reg.Mapping != nil && reg.Mapping.TimeFormat == "" {
+		reg.Mapping.TimeFormat = MappingTimeMillis
+	}
+	if reg.CloudEvents != nil && reg.CloudEvents.Mode == "" {
+		reg.CloudEvents.Mode = CloudEventsStructured
+	}
+	// Sparkplug topics are set by the message types, the topic is only the
+	// one of the group
+	if reg.Format == FormatSparkplugB && reg.Sparkplug != nil && reg.Addressable.Topic == "" {
+		reg.Addressable.Topic = SparkplugNamespace + "/" + reg.Sparkplug.GroupID
+	}
 
-	if reg.Compression != CompNone &&
-		reg.Compression != CompGzip &&
-		reg.Compression != CompZip {
-		return false
+	fields, err := registrationFields(*reg)
+	if err != nil {
+		return err
 	}
 
-	if reg.Format != FormatJSON &&
-		reg.Format != FormatXML &&
-		reg.Format != FormatSerialized &&
-		reg.Format != FormatIoTCoreJSON &&
-		reg.Format != FormatAzureJSON &&
-		reg.Format != FormatCSV {
-		return false
+	stages := []struct {
+		field string
+		value string
+		caps  []Capability
+	}{
+		{"compression", reg.Compression, caps.Compressions},
+		{"format", reg.Format, caps.Formats},
+		{"destination", reg.Destination, caps.Destinations},
+		{"encryption.encryptionAlgorithm", reg.Encryption.Algo, caps.Algorithms},
+	}
+	for _, s := range stages {
+		c := findCapability(s.caps, s.value)
+		if c == nil {
+			errs.add(s.field, CodeInvalid, "unknown "+s.field+" "+s.value)
+			continue
+		}
+		validateParameters(c, fields, &errs)
 	}
 
-	if reg.Destination != DestMQTT &&
-		reg.Destination != DestZMQ &&
-		reg.Destination != DestIotCoreMQTT &&
-		reg.Destination != DestAzureMQTT &&
-		reg.Destination != DestRest {
-		return false
+	if reg.Format == FormatTemplate && reg.Template != nil && reg.Template.Source != "" {
+		if _, err := ParseTemplate(reg.Template.Source); err != nil {
+			errs.add("template.source", CodeInvalid, err.Error())
+		}
+	}
+	if reg.Format == FormatXML {
+		validateXML(reg.XMLOptions(), &errs)
+	}
+	if reg.Format == FormatJSON && reg.Mapping != nil {
+		keys := make([]string, 0, len(reg.Mapping.Rename))
+		for key := range reg.Mapping.Rename {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if reg.Mapping.Rename[key] == "" {
+				errs.add("mapping.rename."+key, CodeInvalid, "fields can not be renamed to an empty name")
+			}
+		}
+	}
+	if reg.Format == FormatSparkplugB {
+		// Sequence numbers are set by the MQTT sender in the payloads
+		if reg.Destination != DestMQTT {
+			errs.add("destination", CodeInvalid, FormatSparkplugB+" requires a "+DestMQTT+" destination")
+		}
+		if reg.Compression != CompNone {
+			errs.add("compression", CodeInvalid, FormatSparkplugB+" payloads can not be compressed")
+		}
+		if reg.Encryption.Algo != EncNone {
+			errs.add("encryption.encryptionAlgorithm", CodeInvalid, FormatSparkplugB+" payloads can not be encrypted")
+		}
+		if reg.CloudEvents != nil {
+			errs.add("cloudEvents", CodeInvalid, FormatSparkplugB+" payloads can not be wrapped in CloudEvents")
+		}
 	}
 
-	if reg.Encryption.Algo == "" {
-		reg.Encryption.Algo = EncNone
+	// A CloudEvent describes a single event
+	if reg.Format == FormatAvroOCF && reg.Avro != nil && reg.Avro.BatchSize > 1 && reg.CloudEvents != nil {
+		errs.add("cloudEvents", CodeInvalid, "batches of "+FormatAvroOCF+" events can not be wrapped in CloudEvents")
+	}
+
+	// SPARKPLUG_B payloads are not wrapped, as reported above
+	if reg.CloudEvents != nil && reg.Format != FormatSparkplugB {
+		// The envelope and its datacontenttype describe the formatted
+		// payload, which compression and encryption would change
+		if reg.Compression != CompNone {
+			errs.add("compression", CodeInvalid, "payloads wrapped in CloudEvents can not be compressed")
+		}
+		if reg.Encryption.Algo != EncNone {
+			errs.add("encryption.encryptionAlgorithm", CodeInvalid, "payloads wrapped in CloudEvents can not be encrypted")
+		}
+		switch reg.CloudEvents.Mode {
+		case CloudEventsStructured:
+		case CloudEventsBinary:
+			// MQTT 3.1.1 has no user properties to carry the attributes
+			if reg.Destination != DestRest {
+				errs.add("cloudEvents.mode", CodeInvalid, "binary mode requires a "+DestRest+" destination")
+			}
+		default:
+			errs.add("cloudEvents.mode", CodeInvalid, "unknown cloudEvents.mode "+reg.CloudEvents.Mode+
+				", expected one of "+CloudEventsStructured+", "+CloudEventsBinary)
+		}
 	}
 
-	if reg.Encryption.Algo != EncNone &&
-		reg.Encryption.Algo != EncAes {
-		return false
+	if reg.Format == FormatInfluxLine && reg.Influx != nil {
+		keys := make([]string, 0, len(reg.Influx.Tags))
+		for key := range reg.Influx.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !contains(influxTagSources, reg.Influx.Tags[key]) {
+				errs.add("influx.tags."+key, CodeInvalid, "unknown tag source "+reg.Influx.Tags[key]+
+					", expected one of "+strings.Join(influxTagSources, ", "))
+			}
+		}
 	}
 
-	return true
+	filters := []string{}
+	for field, v := range fields {
+		if list, ok := v.([]interface{}); ok && len(list) > 0 && strings.HasPrefix(field, "filter.") {
+			filters = append(filters, field)
+		}
+	}
+	sort.Strings(filters)
+	for _, field := range filters {
+		if !supportsField(caps.Filters, field) {
+			errs.add(field, CodeInvalid, "filter not supported")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
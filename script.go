@@ -0,0 +1,28 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Script languages
+const (
+	ScriptLua = "lua"
+)
+
+// ScriptDetails - script of the SCRIPT format. Source defines a transform
+// function, called with each filtered event, which returns the payload and
+// optionally the topic and headers to send it with. Timeout is the time
+// each call may run, in milliseconds, and MemoryLimit the memory it may
+// allocate, in MB, at least 32 as distro samples its own allocations while
+// the script runs. StackLimit is the number of Lua stack slots the script
+// may use, which bounds the depth of its values and not its memory. Distro
+// sets the defaults of all three
+type ScriptDetails struct {
+	Language    string `bson:"language,omitempty" json:"language,omitempty"`
+	Source      string `bson:"source,omitempty" json:"source,omitempty"`
+	Timeout     int    `bson:"timeout,omitempty" json:"timeout,omitempty"`
+	MemoryLimit int    `bson:"memoryLimit,omitempty" json:"memoryLimit,omitempty"`
+	StackLimit  int    `bson:"stackLimit,omitempty" json:"stackLimit,omitempty"`
+}
@@ -0,0 +1,13 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// SenMLDetails - options of the SenML formats. Units maps reading names to
+// their SenML unit, as "Cel" or "%RH"
+type SenMLDetails struct {
+	Units map[string]string `bson:"units,omitempty" json:"units,omitempty"`
+}
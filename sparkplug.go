@@ -0,0 +1,18 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+// Sparkplug B topic namespace
+const SparkplugNamespace = "spBv1.0"
+
+// SparkplugDetails - edge node of the SPARKPLUG_B format. Events are
+// published as DDATA of their device, under
+// spBv1.0/{GroupID}/{type}/{NodeID}/{device}
+type SparkplugDetails struct {
+	GroupID string `bson:"groupId,omitempty" json:"groupId,omitempty"`
+	NodeID  string `bson:"nodeId,omitempty" json:"nodeId,omitempty"`
+}
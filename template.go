@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import (
+	"encoding/json"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// TemplateDetails - text/template of the TEMPLATE format, executed with
+// each filtered Event. ContentType is the content type of the payloads,
+// the default one of the destination if empty
+type TemplateDetails struct {
+	Source      string `bson:"source,omitempty" json:"source,omitempty"`
+	ContentType string `bson:"contentType,omitempty" json:"contentType,omitempty"`
+}
+
+// TemplateFuncs - functions available to the templates:
+//
+//	toJSON value                     - value as JSON
+//	formatTime ms [layout]           - time in ms, as .Origin, in UTC with
+//	                                   layout, RFC 3339 by default
+//	parseFloat string                - number in a string, as Reading.Value
+//	reading event name               - reading of the event by name, nil if
+//	                                   there is none
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"toJSON": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"formatTime": func(ms int64, layout ...string) string {
+			l := time.RFC3339Nano
+			if len(layout) > 0 {
+				l = layout[0]
+			}
+			return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(l)
+		},
+		"parseFloat": func(s string) (float64, error) {
+			return strconv.ParseFloat(s, 64)
+		},
+		"reading": func(event *Event, name string) *Reading {
+			if event == nil {
+				return nil
+			}
+			for i := range event.Readings {
+				if event.Readings[i].Name == name {
+					return &event.Readings[i]
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// ParseTemplate - parse the source of a TEMPLATE format with TemplateFuncs
+func ParseTemplate(source string) (*template.Template, error) {
+	return template.New("registration").Option("missingkey=error").Funcs(TemplateFuncs()).Parse(source)
+}
@@ -0,0 +1,39 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import "strings"
+
+// Validation error codes
+const (
+	CodeRequired   = "required"
+	CodeInvalid    = "invalid"
+	CodeOutOfRange = "out_of_range"
+)
+
+// FieldError - Validation error of a single field. Field is the path of
+// the field in the JSON document, like "addressable.Port"
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError - Field errors found validating a registration
+type ValidationError []FieldError
+
+func (errs *ValidationError) add(field, code, message string) {
+	*errs = append(*errs, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (errs ValidationError) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Field + ": " + e.Message
+	}
+	return "invalid registration: " + strings.Join(msgs, ", ")
+}
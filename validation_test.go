@@ -0,0 +1,226 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import "testing"
+
+func validRegistration() Registration {
+	return Registration{
+		Name:        "reg",
+		Format:      FormatJSON,
+		Destination: DestMQTT,
+		Addressable: Addressable{Address: "127.0.0.1", Port: 1883, Topic: "topic"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		update func(reg *Registration)
+		fields []string
+	}{
+		{func(reg *Registration) {}, nil},
+		{func(reg *Registration) { reg.Format = FormatMsgPack }, nil},
+		{func(reg *Registration) { reg.Format = FormatCBOR }, nil},
+		{func(reg *Registration) { reg.Format = FormatAvro }, nil},
+		{func(reg *Registration) {
+			reg.Mapping = &JSONMapping{Flatten: true, TimeFormat: MappingTimeRFC3339, Rename: map[string]string{"origin": "ts"}}
+		}, nil},
+		{func(reg *Registration) { reg.Mapping = &JSONMapping{TimeFormat: "iso"} }, []string{"mapping.timeFormat"}},
+		{func(reg *Registration) { reg.Mapping = &JSONMapping{Rename: map[string]string{"id": ""}} }, []string{"mapping.rename.id"}},
+		{func(reg *Registration) {
+			reg.Format = FormatAvroOCF
+			reg.Avro = &AvroDetails{Codec: AvroCodecDeflate}
+		}, nil},
+		{func(reg *Registration) {
+			reg.Format = FormatAvroOCF
+			reg.Avro = &AvroDetails{Codec: "bzip2"}
+		}, []string{"avro.codec"}},
+		{func(reg *Registration) {
+			reg.Format = FormatAvroOCF
+			reg.Avro = &AvroDetails{BatchSize: 100, BatchInterval: 5000}
+		}, nil},
+		{func(reg *Registration) {
+			reg.Format = FormatAvroOCF
+			reg.Avro = &AvroDetails{BatchSize: 100000}
+		}, []string{"avro.batchSize"}},
+		{func(reg *Registration) {
+			reg.Format = FormatAvroOCF
+			reg.Avro = &AvroDetails{BatchSize: 100}
+			reg.CloudEvents = &CloudEventsDetails{}
+		}, []string{"cloudEvents"}},
+		{func(reg *Registration) { reg.Name = "" }, []string{"name"}},
+		{func(reg *Registration) { reg.Format = "YAML" }, []string{"format"}},
+		{func(reg *Registration) { reg.Compression = "LZ4" }, []string{"compression"}},
+		{func(reg *Registration) { reg.Destination = "" }, []string{"destination"}},
+		{func(reg *Registration) { reg.Addressable.Topic = "" }, []string{"addressable.Topic"}},
+		{func(reg *Registration) { reg.Addressable.Port = 0 }, []string{"addressable.Port"}},
+		{func(reg *Registration) {
+			reg.Destination = DestRest
+			reg.Addressable.Method = "GO"
+		}, []string{"addressable.Method"}},
+		{func(reg *Registration) {
+			reg.Destination = DestRest
+			reg.Addressable = Addressable{}
+		}, []string{"addressable.Address", "addressable.Port", "addressable.Method"}},
+		{func(reg *Registration) { reg.Encryption.Algo = EncAes }, []string{
+			"encryption.encryptionKey", "encryption.initializingVector"}},
+		{func(reg *Registration) { reg.Encryption.Algo = "DES" }, []string{
+			"encryption.encryptionAlgorithm"}},
+	}
+
+	for i, c := range cases {
+		reg := validRegistration()
+		c.update(&reg)
+
+		err := reg.Validate()
+		if c.fields == nil {
+			if err != nil {
+				t.Errorf("case %d: unexpected error %s", i+1, err)
+			}
+			continue
+		}
+
+		errs, ok := err.(ValidationError)
+		if !ok || len(errs) != len(c.fields) {
+			t.Errorf("case %d: expected errors in %v got %v", i+1, c.fields, err)
+			continue
+		}
+		for j, e := range errs {
+			if e.Field != c.fields[j] {
+				t.Errorf("case %d: expected error in %s got %s", i+1, c.fields[j], e.Field)
+			}
+		}
+	}
+
+	reg := validRegistration()
+	reg.Validate()
+	if reg.Compression != CompNone || reg.Encryption.Algo != EncNone {
+		t.Fatal("Validate should set the default compression and algorithm")
+	}
+}
+
+func TestValidateWith(t *testing.T) {
+	caps := DefaultCapabilities()
+	caps.Formats = []Capability{{Name: FormatJSON}}
+	caps.Filters = nil
+
+	reg := validRegistration()
+	if err := reg.ValidateWith(caps); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	reg.Format = FormatXML
+	reg.Filter.DeviceIDs = []string{"dev"}
+	errs, ok := reg.ValidateWith(caps).(ValidationError)
+	if !ok || len(errs) != 2 || errs[0].Field != "format" || errs[1].Field != "filter.deviceIdentifiers" {
+		t.Fatal("Unsupported format and filter should be rejected", errs)
+	}
+
+	// Distro only sends with GET and POST
+	reg = validRegistration()
+	reg.Destination = DestRest
+	reg.Addressable.Method = MethodPut
+	errs, ok = reg.Validate().(ValidationError)
+	if !ok || len(errs) != 1 || errs[0].Field != "addressable.Method" || errs[0].Code != CodeInvalid {
+		t.Fatal("Unsupported method should be rejected", errs)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	reg := validRegistration()
+	reg.Format = FormatTemplate
+	errs, ok := reg.Validate().(ValidationError)
+	if !ok || len(errs) != 1 || errs[0].Field != "template.source" || errs[0].Code != CodeRequired {
+		t.Fatal("Missing template should be rejected", errs)
+	}
+
+	reg.Template = &TemplateDetails{Source: `{{toJSON .Device}} {{unknown .}}`}
+	errs, ok = reg.Validate().(ValidationError)
+	if !ok || len(errs) != 1 || errs[0].Field != "template.source" || errs[0].Code != CodeInvalid {
+		t.Fatal("Template with unknown function should be rejected", errs)
+	}
+
+	reg.Template.Source = `{{with reading . "temp"}}{{parseFloat .Value}}{{end}} {{formatTime .Origin}}`
+	if err := reg.Validate(); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+}
+
+func TestValidateInflux(t *testing.T) {
+	reg := validRegistration()
+	reg.Format = FormatInfluxLine
+	reg.Influx = &InfluxDetails{
+		Measurement: InfluxMeasurementDevice,
+		Tags:        map[string]string{"sensor": InfluxTagName, "host": "hostname"},
+		Precision:   "m",
+	}
+	errs, ok := reg.Validate().(ValidationError)
+	if !ok || len(errs) != 2 || errs[0].Field != "influx.precision" || errs[1].Field != "influx.tags.host" {
+		t.Fatal("Invalid precision and tag should be rejected", errs)
+	}
+
+	reg = validRegistration()
+	reg.Destination = DestInfluxDB
+	errs, ok = reg.Validate().(ValidationError)
+	if !ok || len(errs) != 3 || errs[0].Field != "addressable.Password" || errs[1].Field != "influx.bucket" ||
+		errs[2].Field != "influx.org" {
+		t.Fatal("Missing token, bucket and org should be rejected", errs)
+	}
+}
+
+func TestValidateCloudEvents(t *testing.T) {
+	reg := validRegistration()
+	reg.CloudEvents = &CloudEventsDetails{}
+	if err := reg.Validate(); err != nil || reg.CloudEvents.Mode != CloudEventsStructured {
+		t.Fatal("Structured mode should be the default", err, reg.CloudEvents)
+	}
+
+	reg.CloudEvents.Mode = CloudEventsBinary
+	errs, ok := reg.Validate().(ValidationError)
+	if !ok || len(errs) != 1 || errs[0].Field != "cloudEvents.mode" {
+		t.Fatal("Binary mode should be rejected for MQTT", errs)
+	}
+
+	reg.Destination = DestRest
+	reg.Addressable.Method = MethodPost
+	if err := reg.Validate(); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	reg.Compression = CompGzip
+	reg.Encryption = EncryptionDetails{Algo: EncAes, Key: "key", InitVector: "iv"}
+	errs, ok = reg.Validate().(ValidationError)
+	if !ok || len(errs) != 2 || errs[0].Field != "compression" ||
+		errs[1].Field != "encryption.encryptionAlgorithm" {
+		t.Fatal("Compressed and encrypted envelopes should be rejected", errs)
+	}
+}
+
+func TestValidateXML(t *testing.T) {
+	reg := validRegistration()
+	reg.Format = FormatXML
+	if err := reg.Validate(); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if d := reg.XMLOptions(); d.Root != XMLDefaultRoot || d.Namespace != XMLDefaultNamespace ||
+		d.Readings != XMLReadingsElements {
+		t.Fatal("Unexpected defaults", d)
+	}
+
+	reg.XML = &XMLDetails{Root: "Data", Namespace: "http://example.com/export", Prefix: "ex",
+		Readings: XMLReadingsAttributes}
+	if err := reg.Validate(); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	reg.XML = &XMLDetails{Root: "1event", Namespace: "export", Prefix: "xmlns", Readings: "text"}
+	errs, ok := reg.Validate().(ValidationError)
+	if !ok || len(errs) != 4 || errs[0].Field != "xml.readings" || errs[1].Field != "xml.root" ||
+		errs[2].Field != "xml.prefix" || errs[3].Field != "xml.namespace" {
+		t.Fatal("Invalid structure should be rejected", errs)
+	}
+}
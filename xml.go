@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2017 Mainflux
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Encodings of the readings of the XML format
+const (
+	XMLReadingsElements   = "elements"
+	XMLReadingsAttributes = "attributes"
+)
+
+// Defaults of the XML format
+const (
+	XMLDefaultRoot      = "event"
+	XMLDefaultNamespace = "urn:edgexfoundry:export:event:1"
+	// Element of the readings, children of the root
+	XMLReadingElement = "reading"
+	// Version of the schema, incremented with every change of the structure
+	XMLSchemaVersion = "1"
+)
+
+// XMLDetails - structure of the documents of the XML format. Root is the
+// name of the root element, with the event fields as attributes, in the
+// Namespace namespace, the default one unless Prefix is set. Readings are
+// reading elements with their fields as child elements or as attributes
+type XMLDetails struct {
+	Root      string `bson:"root,omitempty" json:"root,omitempty"`
+	Namespace string `bson:"namespace,omitempty" json:"namespace,omitempty"`
+	Prefix    string `bson:"prefix,omitempty" json:"prefix,omitempty"`
+	Readings  string `bson:"readings,omitempty" json:"readings,omitempty"`
+}
+
+// Names of elements and prefixes, as the XML NCName without the non ASCII
+// letters
+var xmlNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// XMLOptions - XML structure of the registration, with the defaults of the
+// fields not set
+func (reg *Registration) XMLOptions() XMLDetails {
+	var d XMLDetails
+	if reg.XML != nil {
+		d = *reg.XML
+	}
+	if d.Root == "" {
+		d.Root = XMLDefaultRoot
+	}
+	if d.Namespace == "" {
+		d.Namespace = XMLDefaultNamespace
+	}
+	if d.Readings == "" {
+		d.Readings = XMLReadingsElements
+	}
+	return d
+}
+
+func validateXML(d XMLDetails, errs *ValidationError) {
+	if !xmlNameRegexp.MatchString(d.Root) {
+		errs.add("xml.root", CodeInvalid, "invalid element name "+d.Root)
+	}
+	// Prefixes starting with xml are reserved
+	if d.Prefix != "" && (!xmlNameRegexp.MatchString(d.Prefix) ||
+		strings.HasPrefix(strings.ToLower(d.Prefix), "xml")) {
+		errs.add("xml.prefix", CodeInvalid, "invalid namespace prefix "+d.Prefix)
+	}
+	if u, err := url.Parse(d.Namespace); err != nil || !u.IsAbs() {
+		errs.add("xml.namespace", CodeInvalid, "namespace must be an absolute URI")
+	}
+}
+
+var xmlSchemaTemplate = template.Must(template.New("xsd").Funcs(template.FuncMap{
+	"escape": func(s string) (string, error) {
+		var buf bytes.Buffer
+		err := xml.EscapeText(&buf, []byte(s))
+		return buf.String(), err
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:tns="{{escape .Namespace}}"
+           targetNamespace="{{escape .Namespace}}" elementFormDefault="qualified" version="` + XMLSchemaVersion + `">
+  <xs:element name="{{escape .Root}}">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="` + XMLReadingElement + `" type="tns:Reading" minOccurs="0" maxOccurs="unbounded"/>
+      </xs:sequence>
+      <xs:attribute name="id" type="xs:string"/>
+      <xs:attribute name="device" type="xs:string"/>
+      <xs:attribute name="pushed" type="xs:long" use="required"/>
+      <xs:attribute name="created" type="xs:long" use="required"/>
+      <xs:attribute name="modified" type="xs:long" use="required"/>
+      <xs:attribute name="origin" type="xs:long" use="required"/>
+    </xs:complexType>
+  </xs:element>
+  <xs:complexType name="Reading">
+{{- if eq .Readings "` + XMLReadingsAttributes + `"}}
+    <xs:attribute name="id" type="xs:string"/>
+    <xs:attribute name="name" type="xs:string"/>
+    <xs:attribute name="value" type="xs:string"/>
+    <xs:attribute name="device" type="xs:string"/>
+    <xs:attribute name="pushed" type="xs:long" use="required"/>
+    <xs:attribute name="created" type="xs:long" use="required"/>
+    <xs:attribute name="modified" type="xs:long" use="required"/>
+    <xs:attribute name="origin" type="xs:long" use="required"/>
+{{- else}}
+    <xs:sequence>
+      <xs:element name="id" type="xs:string" minOccurs="0"/>
+      <xs:element name="name" type="xs:string" minOccurs="0"/>
+      <xs:element name="value" type="xs:string" minOccurs="0"/>
+      <xs:element name="device" type="xs:string" minOccurs="0"/>
+      <xs:element name="pushed" type="xs:long"/>
+      <xs:element name="created" type="xs:long"/>
+      <xs:element name="modified" type="xs:long"/>
+      <xs:element name="origin" type="xs:long"/>
+    </xs:sequence>
+{{- end}}
+  </xs:complexType>
+</xs:schema>
+`))
+
+// XMLSchema - XSD of the documents of the XML format with the structure d.
+// The prefix of the elements does not change the schema
+func XMLSchema(d XMLDetails) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := xmlSchemaTemplate.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}